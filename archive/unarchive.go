@@ -75,3 +75,35 @@ func Unarchive(ctx context.Context, src, dst string) (m Metrics, err error) {
 	}
 	return m, nil
 }
+
+// ReadFile reads a single file from the .tar.gz file without extracting the rest of the archive.
+func ReadFile(ctx context.Context, src, name string) (data []byte, err error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open .tar.gz file %q: %w", src, err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%q not found in %q: %w", name, src, os.ErrNotExist)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && filepath.Clean(header.Name) == filepath.Clean(name) {
+			return io.ReadAll(tarReader)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"fmt"
@@ -8,8 +9,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/a-h/flakegap/export"
+	"github.com/a-h/flakegap/gcroots"
 	"github.com/a-h/flakegap/importcmd"
 	"github.com/a-h/flakegap/sloghandler"
 	"github.com/a-h/flakegap/validate"
@@ -40,6 +43,8 @@ func main() {
 		err = importCmd(ctx)
 	case "validate":
 		err = validateCmd(ctx)
+	case "roots":
+		err = rootsCmd(ctx)
 	default:
 		fmt.Printf("flakegap: unknown command %q\n", os.Args[1])
 		fmt.Println()
@@ -77,27 +82,61 @@ func newLogger(logLevel string, verbose bool, stderr io.Writer) *slog.Logger {
 }
 
 func exportCmd(ctx context.Context) error {
-	args := export.Args{}
+	args := export.Args{
+		Version: version,
+	}
 	var verboseFlag bool
 	var logLevelFlag string
+	var architectureFlag, platformFlag string
+	var sourcePathFlag []string
 	cmdFlags := flag.NewFlagSet("export", flag.ContinueOnError)
-	cmdFlags.StringVar(&args.Code, "source-path", ".", "Path to the directory containing the flake.")
+	cmdFlags.Var((*stringsFlag)(&sourcePathFlag), "source-path", "Path to the directory containing the flake, defaults to . - can be repeated to export multiple flakes in one bundle")
+	cmdFlags.StringVar(&args.Discover, "discover", "", "Directory to search for flake.nix files, to export every flake within it in one bundle")
 	cmdFlags.StringVar(&args.ExportFileName, "export-filename", "", "Filename to write the output file to - defaults to <source-path>/nix-export.tar.gz")
-	cmdFlags.StringVar(&args.Architecture, "architecture", "x86_64", "Architecture to build for, e.g. x86_64, aarch64")
-	cmdFlags.StringVar(&args.Platform, "platform", "linux", "Platform to build for, e.g. linux, darwin")
+	cmdFlags.StringVar(&architectureFlag, "architecture", "x86_64", "Architecture to build for, e.g. x86_64, aarch64 - ignored if -system is set")
+	cmdFlags.StringVar(&platformFlag, "platform", "linux", "Platform to build for, e.g. linux, darwin - ignored if -system is set")
+	cmdFlags.Var((*stringsFlag)(&args.Systems), "system", "Nix system to build for, e.g. x86_64-linux, can be repeated to export multiple systems in one bundle")
+	cmdFlags.Var((*stringsFlag)(&args.Include), "include", "Glob pattern of output attribute paths to export, e.g. packages.*.default, prefix with ! to exclude, can be repeated")
+	cmdFlags.Var((*stringsFlag)(&args.Exclude), "exclude", "Glob pattern of output attribute paths to skip, e.g. packages.*.*-docker-image, can be repeated")
+	cmdFlags.Var((*stringsFlag)(&args.ExtraInstallables), "extra-installable", "Installable to export in addition to the flake outputs, e.g. nixpkgs#git, can be repeated")
+	cmdFlags.Var((*stringsFlag)(&args.ExtraPaths), "extra-path", "Store path, or symlink to a store path such as ~/.nix-profile, to export in addition to the flake outputs, can be repeated")
 	cmdFlags.BoolVar(&verboseFlag, "v", false, "")
 	cmdFlags.StringVar(&logLevelFlag, "log-level", "info", "")
 	cmdFlags.StringVar(&args.TemporaryPath, "temporary-path", "", "Directory to write temporary files to")
 	cmdFlags.BoolVar(&args.ExportNix, "export-nix", true, "Export the Nix store paths required to build the flake.")
+	cmdFlags.IntVar(&args.Jobs, "jobs", 1, "Number of outputs to build and copy concurrently")
+	cmdFlags.StringVar(&args.SourceFiles, "source-files", "gitignore", "Source files to export, gitignore to copy files not ignored by .gitignore and .flakegapignore files, or git to copy only the files tracked by git")
+	cmdFlags.StringVar(&args.Flake, "flake", "", "Flake reference to export instead of source-path, e.g. github:owner/repo/v1.0.0")
+	cmdFlags.BoolVar(&args.RequireClean, "require-clean", false, "Stop the export if the git repository has uncommitted changes")
+	cmdFlags.StringVar(&args.Rev, "rev", "", "Git ref, e.g. a tag or commit, to export from a temporary worktree instead of the working directory")
+	cmdFlags.StringVar(&args.GitMissing, "git-missing", "warn", "What to do when git submodules are not initialised, or Git LFS files have not been pulled, warn or fail")
+	cmdFlags.BoolVar(&args.GitBundle, "git-bundle", false, "Include a git bundle of the repository and its submodules in the export")
+	cmdFlags.StringVar(&args.Closure, "closure", "build", "Closure to export, build to export everything required to rebuild the outputs, runtime to export only what's required to run them, or sources to export only derivations and fixed-output sources so that everything is rebuilt on the target")
+	cmdFlags.BoolVar(&args.DryRun, "dry-run", false, "List the outputs that would be exported, what would be built and fetched, and their closure sizes, without exporting")
+	cmdFlags.Var((*stringsFlag)(&args.Since), "since", "Previous nix-export.tar.gz or nix-export.txt file, store paths it contains are left out of the export, can be repeated")
 	cmdFlags.BoolVar(&args.Help, "help", false, "Show usage and quit")
 	cmdFlags.Parse(os.Args[2:])
+	switch {
+	case len(sourcePathFlag) > 1:
+		args.SourcePaths = sourcePathFlag
+	case len(sourcePathFlag) == 1:
+		args.Code = sourcePathFlag[0]
+	case args.Discover == "" && args.Flake == "":
+		args.Code = "."
+	}
 	if args.ExportFileName == "" {
-		args.ExportFileName = filepath.Join(args.Code, "nix-export.tar.gz")
+		args.ExportFileName = filepath.Join(cmp.Or(args.Code, args.Discover, "."), "nix-export.tar.gz")
+	}
+	if len(args.Systems) == 0 {
+		args.Systems = []string{architectureFlag + "-" + platformFlag}
 	}
 	if args.Help {
 		cmdFlags.PrintDefaults()
 		os.Exit(1)
 	}
+	if err := args.Validate(); err != nil {
+		return err
+	}
 	log := newLogger(logLevelFlag, verboseFlag, os.Stderr)
 	return export.Run(ctx, log, args)
 }
@@ -111,12 +150,22 @@ func importCmd(ctx context.Context) error {
 	cmdFlags.BoolVar(&verboseFlag, "v", false, "")
 	cmdFlags.StringVar(&logLevelFlag, "log-level", "info", "")
 	cmdFlags.StringVar(&args.TemporaryPath, "temporary-path", "", "Directory to write temporary files to")
+	cmdFlags.StringVar(&args.SourceDest, "source-dest", "", "Directory to restore the exported source code to")
+	cmdFlags.StringVar(&args.OutputsDest, "outputs-dest", "", "Directory to restore the exported build outputs to")
+	cmdFlags.Var((*stringsFlag)(&args.Outputs), "output", "Glob pattern of output names to import, e.g. devShells.x86_64-linux.default, only the closures of matching outputs are imported, can be repeated")
+	cmdFlags.BoolVar(&args.GCRoots, "gc-roots", false, "Create GC roots for the imported outputs, devShells and the rest of the imported store paths, so that they're not deleted by nix-collect-garbage")
+	cmdFlags.StringVar(&args.GCRootsDir, "gc-roots-dir", gcroots.DefaultDir, "Directory to create GC roots in, each import creates roots in a subdirectory named after the export ID")
+	cmdFlags.BoolVar(&args.DryRun, "dry-run", false, "Report which store paths are new and which are already present, and which outputs would become available, without importing")
+	cmdFlags.BoolVar(&args.Force, "force", false, "Restore to source-dest and outputs-dest even if they're not empty, overwriting existing files")
 	cmdFlags.BoolVar(&args.Help, "help", false, "Show usage and quit")
 	cmdFlags.Parse(os.Args[2:])
 	if args.Help {
 		cmdFlags.PrintDefaults()
 		os.Exit(1)
 	}
+	if err := args.Validate(); err != nil {
+		return err
+	}
 	log := newLogger(logLevelFlag, verboseFlag, os.Stderr)
 	return importcmd.Run(ctx, log, args)
 }
@@ -129,6 +178,8 @@ func validateCmd(ctx context.Context) error {
 	cmdFlags.StringVar(&args.ExportFileName, "export-filename", "nix-export.tar.gz", "Filename of the nix-export.tar.gz file, defaults to nix-export.tar.gz")
 	cmdFlags.StringVar(&args.Platform, "platform", "amd64", "Platform to run the export on, e.g. amd64 / x86_64, arm64 / aarch64")
 	cmdFlags.StringVar(&args.Image, "image", "ghcr.io/a-h/flakegap:latest", "Image to run")
+	cmdFlags.Var((*stringsFlag)(&args.Include), "include", "Glob pattern of output attribute paths to build, e.g. packages.*.default, prefix with ! to exclude, can be repeated, defaults to the patterns the export was created with")
+	cmdFlags.Var((*stringsFlag)(&args.Exclude), "exclude", "Glob pattern of output attribute paths to skip, e.g. packages.*.*-docker-image, can be repeated, defaults to the patterns the export was created with")
 	cmdFlags.BoolVar(&verboseFlag, "v", false, "")
 	cmdFlags.StringVar(&logLevelFlag, "log-level", "info", "")
 	cmdFlags.BoolVar(&args.Help, "help", false, "Show usage and quit")
@@ -137,10 +188,50 @@ func validateCmd(ctx context.Context) error {
 		cmdFlags.PrintDefaults()
 		os.Exit(1)
 	}
+	if err := args.Validate(); err != nil {
+		return err
+	}
 	log := newLogger(logLevelFlag, verboseFlag, os.Stderr)
 	return validate.Run(ctx, log, args)
 }
 
+func rootsCmd(ctx context.Context) error {
+	args := gcroots.Args{}
+	var verboseFlag bool
+	var logLevelFlag string
+	cmdFlags := flag.NewFlagSet("roots", flag.ContinueOnError)
+	cmdFlags.StringVar(&args.Dir, "dir", gcroots.DefaultDir, "Directory containing the GC roots created by import -gc-roots")
+	cmdFlags.Var((*stringsFlag)(&args.Remove), "remove", "ID of an imported export to remove the GC roots of, can be repeated")
+	cmdFlags.BoolVar(&verboseFlag, "v", false, "")
+	cmdFlags.StringVar(&logLevelFlag, "log-level", "info", "")
+	cmdFlags.BoolVar(&args.Help, "help", false, "Show usage and quit")
+	cmdFlags.Parse(os.Args[2:])
+	if args.Help {
+		cmdFlags.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := args.Validate(); err != nil {
+		return err
+	}
+	log := newLogger(logLevelFlag, verboseFlag, os.Stderr)
+	return gcroots.Run(ctx, log, args)
+}
+
+// stringsFlag is a flag that can be repeated to collect multiple values.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func printUsage() {
 	fmt.Println(`flakegap
 
@@ -157,6 +248,9 @@ Usage:
   flakegap import
     - Imports the output of the export command into the local Nix store.
 
+  flakegap roots
+    - Lists and removes the GC roots of imported exports.
+
   flakegap version
     - Print the version of flakegap.`)
 }
@@ -1,67 +1,149 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"strings"
 
 	"log/slog"
 	"os"
 
+	"github.com/a-h/flakegap/importcmd"
+	"github.com/a-h/flakegap/manifest"
 	"github.com/a-h/flakegap/nixcmd"
 )
 
 var version string
 
+type Args struct {
+	// Architecture to build for, e.g. x86_64, aarch64.
+	Architecture string
+	// Platform to build for, e.g. linux, darwin.
+	Platform string
+	// CodeDirs are the directories containing the flakes to validate, one for each flake of a workspace export.
+	CodeDirs []string
+	// SourceStore is the store to restore the Nix store paths from.
+	SourceStore string
+	// Include is a list of glob patterns over attribute paths of outputs to build.
+	Include []string
+	// Exclude is a list of glob patterns over attribute paths of outputs to skip.
+	Exclude []string
+	// Closure is the closure mode of the export. Outputs of build and sources exports are rebuilt, while outputs of
+	// runtime exports are checked to be present in the store. Sources exports contain no built outputs, so every
+	// dependency is rebuilt from source.
+	Closure string
+}
+
 func main() {
 	log := slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
 	log = log.With(slog.String("version", version))
 	log = log.With(slog.String("flakegap", "server"))
 
-	var architecture, platform string
-	var codeDir string
-	var sourceStore string
+	var args Args
 	cmdFlags := flag.NewFlagSet("runtime", flag.ContinueOnError)
-	cmdFlags.StringVar(&architecture, "architecture", "x86_64", "Architecture to build for, e.g. x86_64, aarch64")
-	cmdFlags.StringVar(&platform, "platform", "linux", "Platform to build for, e.g. linux, darwin")
-	cmdFlags.StringVar(&codeDir, "code-dir", "/code", "Code directory")
-	cmdFlags.StringVar(&sourceStore, "source-store", "file:///nix-export/nix-store/", "Source store")
+	cmdFlags.StringVar(&args.Architecture, "architecture", "x86_64", "Architecture to build for, e.g. x86_64, aarch64")
+	cmdFlags.StringVar(&args.Platform, "platform", "linux", "Platform to build for, e.g. linux, darwin")
+	cmdFlags.Var((*stringsFlag)(&args.CodeDirs), "code-dir", "Code directory, defaults to /code - can be repeated to validate multiple flakes")
+	cmdFlags.StringVar(&args.SourceStore, "source-store", "file:///nix-export/nix-store/", "Source store")
+	cmdFlags.Var((*stringsFlag)(&args.Include), "include", "Glob pattern of output attribute paths to build, can be repeated")
+	cmdFlags.Var((*stringsFlag)(&args.Exclude), "exclude", "Glob pattern of output attribute paths to skip, can be repeated")
+	cmdFlags.StringVar(&args.Closure, "closure", "build", "Closure mode of the export, build, runtime or sources")
 	cmdFlags.Parse(os.Args[1:])
+	if len(args.CodeDirs) == 0 {
+		args.CodeDirs = []string{"/code"}
+	}
 
-	if err := run(log, architecture, platform, codeDir, sourceStore); err != nil {
+	if err := run(context.Background(), log, args); err != nil {
 		log.Error("fatal error", slog.Any("error", err))
 		os.Exit(1)
 	}
 	log.Info("Runtime complete")
 }
 
-func run(log *slog.Logger, architecture, platform, codeDir, sourceStore string) (err error) {
-	log = log.With(slog.String("architecture", architecture), slog.String("platform", platform))
-	log.Info("Restoring Nix store from export", slog.String("source-store", sourceStore))
+func run(ctx context.Context, log *slog.Logger, args Args) (err error) {
+	log = log.With(slog.String("architecture", args.Architecture), slog.String("platform", args.Platform))
+
+	filter, err := nixcmd.NewOutputFilter(args.Include, args.Exclude)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Restoring Nix store from export", slog.String("source-store", args.SourceStore))
 
 	// nix copy --all --no-check-sigs --from file:///nix-export/nix-store/
 	// nix copy --all --derivation --no-check-sigs --from file:///nix-export/nix-store/
-	if err = nixcmd.CopyFromAll(os.Stdout, os.Stderr, codeDir, sourceStore); err != nil {
-		return fmt.Errorf("failed to copy from /nix-export/nix-store: %w", err)
+	if err = importcmd.CopyStore(ctx, log, args.CodeDirs[0], strings.TrimPrefix(args.SourceStore, "file://"), nil); err != nil {
+		return err
 	}
 
+	for _, codeDir := range args.CodeDirs {
+		if err = validateFlake(ctx, log.With(slog.String("codeDir", codeDir)), args, filter, codeDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFlake builds the outputs of the flake in codeDir, or for runtime exports, checks that they're present.
+func validateFlake(ctx context.Context, log *slog.Logger, args Args, filter nixcmd.OutputFilter, codeDir string) (err error) {
 	log.Info("Gathering Nix outputs")
 	// nix flake show --json
 	op, err := nixcmd.FlakeShow(os.Stdout, os.Stderr, codeDir)
 	if err != nil {
 		return fmt.Errorf("failed to gather nix outputs: %w", err)
 	}
-	drvs := op.Derivations(architecture, platform)
+	installables, err := nixcmd.Installables(os.Stdout, os.Stderr, codeDir, op, filter, args.Architecture+"-"+args.Platform)
+	if err != nil {
+		return fmt.Errorf("failed to find outputs: %w", err)
+	}
 
-	log.Info("Building", slog.Any("outputs", drvs))
-	for _, ref := range drvs {
-		log.Info("Building", slog.String("ref", ref))
-		// nix build <ref>
-		if err := nixcmd.Build(os.Stdout, os.Stderr, codeDir, ref); err != nil {
+	if args.Closure == manifest.ClosureRuntime {
+		return checkRuntime(ctx, log, codeDir, installables)
+	}
+
+	log.Info("Building", slog.Any("outputs", installables), slog.String("closure", args.Closure))
+	for _, installable := range installables {
+		ref := installable.Ref
+		log.Info("Building", slog.String("ref", ref), slog.String("output", installable.Attribute))
+		// nix build --no-link --json <ref>
+		if _, err := nixcmd.Build(ctx, os.Stdout, os.Stderr, codeDir, ref); err != nil {
 			log.Error("failed to build", slog.String("ref", ref), slog.Any("error", err))
-			return fmt.Errorf("failed to build %q: %w", ref, err)
+			return fmt.Errorf("failed to build %q in %q: %w", ref, codeDir, err)
+		}
+	}
+
+	return nil
+}
+
+// checkRuntime checks that the outputs of a runtime export are present in the store, since their build closures
+// are not exported, so they can't be built.
+func checkRuntime(ctx context.Context, log *slog.Logger, codeDir string, installables []nixcmd.Installable) (err error) {
+	log.Info("Checking runtime closures are present", slog.Any("outputs", installables))
+	for _, installable := range installables {
+		ref := installable.Ref
+		log.Info("Checking", slog.String("ref", ref), slog.String("output", installable.Attribute))
+		// nix path-info --recursive <ref>
+		if _, err := nixcmd.PathInfo(ctx, os.Stdout, os.Stderr, codeDir, true, false, ref); err != nil {
+			log.Error("runtime closure is not present", slog.String("ref", ref), slog.Any("error", err))
+			return fmt.Errorf("runtime closure of %q is not present: %w", ref, err)
 		}
 	}
+	return nil
+}
+
+// stringsFlag is a flag that can be repeated to collect multiple values.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ", ")
+}
 
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
 	return nil
 }
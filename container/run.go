@@ -56,7 +56,18 @@ func (p Platform) String() string {
 	return fmt.Sprintf("%s/%s", p.Platform, p.Architecture)
 }
 
-func Run(ctx context.Context, log *slog.Logger, containerPlatform Platform, imageRef, codePath, nixExportPath, architecture, platform string) (err error) {
+var dockerArchitectureToNixArchitecture = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+// NixSystem returns the Nix system that runs on the platform, e.g. "x86_64-linux".
+func (p Platform) NixSystem() string {
+	return fmt.Sprintf("%s-%s", dockerArchitectureToNixArchitecture[p.Architecture], p.Platform)
+}
+
+// Run the validate command in a container without network access. The validateArgs are passed to the validate command.
+func Run(ctx context.Context, log *slog.Logger, containerPlatform Platform, imageRef, codePath, nixExportPath string, validateArgs []string) (err error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return fmt.Errorf("failed to create docker client: %w", err)
@@ -81,6 +92,7 @@ func Run(ctx context.Context, log *slog.Logger, containerPlatform Platform, imag
 		AttachStderr: true,
 		Image:        imageRef,
 		Entrypoint:   []string{"/usr/local/bin/validate"},
+		Cmd:          validateArgs,
 	}
 	cconf.NetworkDisabled = true
 	hconf := &container.HostConfig{
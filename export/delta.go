@@ -0,0 +1,81 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/a-h/flakegap/archive"
+	"github.com/a-h/flakegap/manifest"
+	"github.com/nix-community/go-nix/pkg/narinfo"
+)
+
+// readBaseManifests reads the store paths of previous exports from either their nix-export.tar.gz or nix-export.txt files.
+func readBaseManifests(ctx context.Context, fileNames []string) (paths map[string]struct{}, err error) {
+	paths = make(map[string]struct{})
+	for _, fileName := range fileNames {
+		basePaths, err := readBaseManifest(ctx, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read base export %q: %w", fileName, err)
+		}
+		for _, p := range basePaths {
+			paths[p] = struct{}{}
+		}
+	}
+	return paths, nil
+}
+
+func readBaseManifest(ctx context.Context, fileName string) (paths []string, err error) {
+	if !strings.HasSuffix(fileName, ".tar.gz") {
+		return manifest.ReadPathsFile(fileName)
+	}
+	data, err := archive.ReadFile(ctx, fileName, manifest.FileName)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.ReadPaths(bytes.NewReader(data))
+}
+
+// removeBasePaths removes the store paths that are present in the base exports from the target store directory.
+// NAR files are content-addressed, so different store paths can share the same NAR. A NAR is only removed once no
+// remaining narinfo file refers to it.
+func removeBasePaths(ctx context.Context, log *slog.Logger, storeDir string, base map[string]struct{}) (removed int, err error) {
+	narInfos := make(map[string]*narinfo.NarInfo)
+	urlRefs := make(map[string]int)
+	err = manifest.WalkNarInfos(ctx, storeDir, func(fileName string, ni *narinfo.NarInfo) error {
+		narInfos[fileName] = ni
+		if ni.URL != "" {
+			urlRefs[ni.URL]++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+	for _, fileName := range slices.Sorted(maps.Keys(narInfos)) {
+		ni := narInfos[fileName]
+		if _, ok := base[ni.StorePath]; !ok {
+			continue
+		}
+		if err = os.Remove(fileName); err != nil {
+			return removed, fmt.Errorf("failed to remove narinfo %q: %w", fileName, err)
+		}
+		if ni.URL != "" {
+			urlRefs[ni.URL]--
+			if urlRefs[ni.URL] == 0 {
+				if err = os.Remove(filepath.Join(storeDir, ni.URL)); err != nil && !os.IsNotExist(err) {
+					return removed, fmt.Errorf("failed to remove NAR %q: %w", ni.URL, err)
+				}
+			}
+		}
+		log.Debug("Removed path present in base export", slog.String("path", ni.StorePath))
+		removed++
+	}
+	return removed, nil
+}
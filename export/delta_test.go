@@ -0,0 +1,53 @@
+package export
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRemoveBasePaths(t *testing.T) {
+	storeDir := t.TempDir()
+	narInfos := map[string]string{
+		// a and b have the same contents, so share a NAR.
+		"aaaa.narinfo": "StorePath: /nix/store/aaaa-base\nURL: nar/shared.nar.xz\nCompression: xz\nNarHash: sha256:1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s\nNarSize: 10\n",
+		"bbbb.narinfo": "StorePath: /nix/store/bbbb-delta\nURL: nar/shared.nar.xz\nCompression: xz\nNarHash: sha256:1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s\nNarSize: 10\n",
+		"cccc.narinfo": "StorePath: /nix/store/cccc-base\nURL: nar/base.nar.xz\nCompression: xz\nNarHash: sha256:1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s\nNarSize: 10\n",
+	}
+	for name, content := range narInfos {
+		if err := os.WriteFile(filepath.Join(storeDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(storeDir, "nar"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"nar/shared.nar.xz", "nar/base.nar.xz"} {
+		if err := os.WriteFile(filepath.Join(storeDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := map[string]struct{}{
+		"/nix/store/aaaa-base": {},
+		"/nix/store/cccc-base": {},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	removed, err := removeBasePaths(context.Background(), log, storeDir, base)
+	if err != nil {
+		t.Fatalf("failed to remove base paths: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 paths to be removed, got %d", removed)
+	}
+
+	expected := []string{"bbbb.narinfo", "nar/shared.nar.xz"}
+	if diff := cmp.Diff(expected, walkFiles(t, os.DirFS(storeDir))); diff != "" {
+		t.Error(diff)
+	}
+}
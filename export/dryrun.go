@@ -0,0 +1,131 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+	"github.com/dustin/go-humanize"
+)
+
+// dryRun reports the outputs that would be exported, the derivations that would be built and the store paths that
+// would be fetched to export them, and their closure sizes, without building anything or writing to the target store.
+//
+// Closure sizes are only known for outputs that are already in the local store. They're the runtime closures of the
+// outputs, so build exports, which include the build dependencies, are larger.
+func dryRun(ctx context.Context, log *slog.Logger, args Args, flakes []workspaceFlake, w io.Writer) (err error) {
+	extraJobs, err := getExtraJobs(args)
+	if err != nil {
+		return err
+	}
+
+	var result nixcmd.DryRunResult
+	sizes := make(map[string]uint64)
+	var missing int
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAKE\tOUTPUT\tSYSTEM\tCLOSURE SIZE")
+	for _, f := range flakes {
+		args := args
+		args.Code = f.Code
+		log := log
+		if f.Name != "" {
+			log = log.With(slog.String("flake", f.Name))
+		}
+
+		log.Info("Finding outputs", slog.Any("systems", args.Systems))
+		jobs, err := getJobs(log, args, f.Name)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, extraJobs...)
+		extraJobs = nil
+		refs := make([]string, len(jobs))
+		for i, job := range jobs {
+			refs[i] = job.Ref
+		}
+
+		log.Info("Checking what would be built and fetched", slog.Int("outputs", len(jobs)))
+		// nix build --dry-run --no-link <refs>
+		r, err := nixcmd.BuildDryRun(ctx, io.Discard, os.Stderr, args.Code, refs...)
+		if err != nil {
+			return fmt.Errorf("failed to dry run build: %w", err)
+		}
+		result.Build = append(result.Build, r.Build...)
+		result.Fetch = append(result.Fetch, r.Fetch...)
+		result.FetchSizes = append(result.FetchSizes, r.FetchSizes...)
+
+		log.Info("Getting closure sizes")
+		var presentRefs []string
+		for _, job := range jobs {
+			// nix path-info --closure-size <ref>
+			// The paths of outputs that haven't been built or fetched are not valid, so their size is unknown.
+			entries, err := nixcmd.PathInfoEntries(ctx, io.Discard, io.Discard, args.Code, nixcmd.PathInfoOptions{ClosureSize: true}, job.Ref)
+			size := "not in local store"
+			if err == nil {
+				// The closures of multiple outputs of a derivation overlap, so the total is an upper bound.
+				var closureSize uint64
+				for _, e := range entries {
+					closureSize += e.ClosureSize
+				}
+				size = humanize.Bytes(closureSize)
+				presentRefs = append(presentRefs, job.Ref)
+			} else {
+				missing++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Name, job.Name, job.System, size)
+		}
+		if len(presentRefs) == 0 {
+			continue
+		}
+		// nix path-info --recursive <refs>
+		entries, err := nixcmd.PathInfoEntries(ctx, io.Discard, os.Stderr, args.Code, nixcmd.PathInfoOptions{Recursive: true}, presentRefs...)
+		if err != nil {
+			return fmt.Errorf("failed to get closures: %w", err)
+		}
+		for _, e := range entries {
+			sizes[e.Path] = e.NarSize
+		}
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+
+	// Flakes and batches of refs share dependencies.
+	slices.Sort(result.Build)
+	result.Build = slices.Compact(result.Build)
+	slices.Sort(result.Fetch)
+	result.Fetch = slices.Compact(result.Fetch)
+	if args.Closure == manifest.ClosureSources {
+		// Sources exports don't build anything, the outputs are built from source on the target.
+		fmt.Fprintf(w, "\n%d derivations would be built on the target:\n", len(result.Build))
+	} else {
+		fmt.Fprintf(w, "\n%d derivations would be built:\n", len(result.Build))
+	}
+	for _, p := range result.Build {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+	fmt.Fprintf(w, "\n%d paths would be fetched:\n", len(result.Fetch))
+	for _, p := range result.Fetch {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+	for _, s := range result.FetchSizes {
+		fmt.Fprintf(w, "  (%s)\n", s)
+	}
+
+	var total uint64
+	for _, size := range sizes {
+		total += size
+	}
+	fmt.Fprintf(w, "\nTotal closure size: %s in %d store paths", humanize.Bytes(total), len(sizes))
+	if missing > 0 {
+		fmt.Fprintf(w, ", excluding %d outputs that are not in the local store", missing)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
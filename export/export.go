@@ -5,15 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"log/slog"
+	"maps"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/a-h/flakegap/archive"
+	"github.com/a-h/flakegap/gitcmd"
+	"github.com/a-h/flakegap/manifest"
 	"github.com/a-h/flakegap/nixcmd"
 	"github.com/dustin/go-humanize"
 	"github.com/nix-community/go-nix/pkg/narinfo"
@@ -22,35 +28,124 @@ import (
 type Args struct {
 	// Code is the path to the repo on disk that contains a flake.nix file.
 	Code string
+	// SourcePaths are the directories of several flakes to export to a single bundle, as a workspace, instead of Code.
+	// The source code of each flake is copied to sources/<name>, where name is the directory name of the flake.
+	SourcePaths []string
+	// Discover is a directory to search for flake.nix files, to export every flake within it as a workspace. Each flake
+	// is named by its slash separated path within the directory, e.g. services/api.
+	Discover string
 	// ExportFileName is the path to write the output to, e.g. /tmp/nix-export.tar.gz.
 	ExportFileName string
-	// Architecture to build for.
-	Architecture string
-	// Platform to build for.
-	Platform string
+	// Systems to build for, e.g. x86_64-linux, aarch64-linux.
+	Systems []string
+	// Include is a list of glob patterns over attribute paths of outputs to export, e.g. packages.*.default.
+	// Patterns that start with "!" exclude matching outputs.
+	Include []string
+	// Exclude is a list of glob patterns over attribute paths of outputs to skip, e.g. packages.*.*-docker-image.
+	Exclude []string
 	// TemporaryPath is the path to write temporary files to. Defaults to a temporary directory in your home folder, because
 	// some Linux systems have a very small /tmp partition or hold /tmp in memory (e.g. tmpfs) which makes it unsuitable for
 	// large builds.
 	TemporaryPath string
 	// ExportNix indicates whether to export Nix packages.
 	ExportNix bool
+	// Since is a list of previous exports, either nix-export.tar.gz or nix-export.txt files. Store paths that are present in
+	// the previous exports are left out of this export, which can only be imported into a store that the previous exports
+	// have already been imported into.
+	Since []string
 	// Help shows usage and quits.
 	Help bool
+	// Version of flakegap, recorded in the manifest.
+	Version string
+	// Jobs is the number of outputs to build and copy concurrently.
+	Jobs int
+	// ExtraInstallables are installables to export in addition to the outputs of the flake, e.g. nixpkgs#git.
+	ExtraInstallables []string
+	// ExtraPaths are store paths to export in addition to the outputs of the flake, e.g. /nix/store/<hash>-jq or
+	// ~/.nix-profile. Symlinks are followed to find the store path.
+	ExtraPaths []string
+	// SourceFiles selects the source code files to export, either gitignore (the default) to copy files that are not
+	// ignored by .gitignore and .flakegapignore files, or git to copy the files tracked by git.
+	SourceFiles string
+	// Flake is a flake reference to export instead of Code, e.g. github:a-h/flakegap/v0.0.1. The flake is evaluated
+	// and built from the store path that Nix fetches its source to, which is also copied to source/ in the export.
+	Flake string
+	// RequireClean stops the export if tracked files in the git repository have uncommitted changes, or, if SourceFiles
+	// is gitignore, if there are untracked files that are not ignored.
+	RequireClean bool
+	// Rev is a git ref, such as a tag or commit hash, to export instead of the working directory. It's checked out to
+	// a temporary git worktree.
+	Rev string
+	// GitMissing is the policy for submodules and Git LFS files that are missing from the working tree, either warn
+	// (the default) or fail.
+	GitMissing string
+	// GitBundle writes a git bundle of the repository and its submodules to the export.
+	GitBundle bool
+	// DryRun reports what would be built and fetched to export the outputs, and their closure sizes, without exporting
+	// anything.
+	DryRun bool
+	// Closure is the closure mode, either build (the default) to export everything required to rebuild the outputs,
+	// runtime to export only what's required to run them, or sources to export only the derivations and fixed-output
+	// sources, so that the outputs have to be rebuilt from source.
+	Closure string
 }
 
 func (a Args) Validate() error {
 	var errs []error
-	if a.Code == "" {
+	workspace := len(a.SourcePaths) > 0 || a.Discover != ""
+	if a.Code == "" && !workspace && a.Flake == "" {
 		errs = append(errs, fmt.Errorf("source-path is required"))
 	}
+	if a.Discover != "" && (a.Code != "" || len(a.SourcePaths) > 0) {
+		errs = append(errs, fmt.Errorf("source-path can't be used with discover"))
+	}
+	if workspace && (a.Flake != "" || a.Rev != "") {
+		errs = append(errs, fmt.Errorf("flake and rev can only be used to export a single flake"))
+	}
 	if a.ExportFileName == "" {
 		errs = append(errs, fmt.Errorf("export-filename is required"))
 	}
-	if a.Architecture == "" {
-		errs = append(errs, fmt.Errorf("architecture is required"))
+	if len(a.Systems) == 0 {
+		errs = append(errs, fmt.Errorf("at least one system is required"))
+	}
+	for _, system := range a.Systems {
+		if _, _, err := nixcmd.SplitSystem(system); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := nixcmd.NewOutputFilter(a.Include, a.Exclude); err != nil {
+		errs = append(errs, err)
+	}
+	for _, p := range a.ExtraPaths {
+		if _, err := getStorePath(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.SourceFiles != SourceFilesGitignore && a.SourceFiles != SourceFilesGit {
+		errs = append(errs, fmt.Errorf("source-files must be %q or %q, got %q", SourceFilesGitignore, SourceFilesGit, a.SourceFiles))
 	}
-	if a.Platform == "" {
-		errs = append(errs, fmt.Errorf("platform is required"))
+	if a.Flake != "" {
+		if a.Code != "" || a.Discover != "" {
+			errs = append(errs, fmt.Errorf("source-path and discover can't be used with flake, because the flake source is fetched by Nix"))
+		}
+		if a.Rev != "" {
+			errs = append(errs, fmt.Errorf("rev can't be used with flake, add the revision to the flake reference instead"))
+		}
+		if a.RequireClean || a.GitBundle {
+			errs = append(errs, fmt.Errorf("require-clean and git-bundle can't be used with flake, because the flake source is not a git repository"))
+		}
+		if a.SourceFiles == SourceFilesGit {
+			errs = append(errs, fmt.Errorf("source-files %q can't be used with flake, because the flake source is not a git repository", SourceFilesGit))
+		}
+	}
+	if a.GitMissing != GitMissingWarn && a.GitMissing != GitMissingFail {
+		errs = append(errs, fmt.Errorf("git-missing must be %q or %q, got %q", GitMissingWarn, GitMissingFail, a.GitMissing))
+	}
+	if a.Jobs < 1 {
+		errs = append(errs, fmt.Errorf("jobs must be at least 1"))
+	}
+	if !slices.Contains([]string{manifest.ClosureBuild, manifest.ClosureRuntime, manifest.ClosureSources}, a.Closure) {
+		errs = append(errs, fmt.Errorf("closure must be %q, %q or %q, got %q", manifest.ClosureBuild, manifest.ClosureRuntime, manifest.ClosureSources, a.Closure))
 	}
 	return errors.Join(errs...)
 }
@@ -73,23 +168,73 @@ func Run(ctx context.Context, log *slog.Logger, args Args) (err error) {
 	}
 	defer os.RemoveAll(nixExportPath)
 
-	log.Info("Exporting Nix closures")
-	if err := exportNix(ctx, log, args, nixExportPath); err != nil {
-		return fmt.Errorf("failed to export Nix closures: %w", err)
+	if args.Flake != "" {
+		log.Info("Fetching flake", slog.String("flake", args.Flake))
+		// nix flake metadata --json <flake>
+		metadata, err := nixcmd.FlakeMetadata(io.Discard, os.Stderr, "", args.Flake)
+		if err != nil {
+			return fmt.Errorf("failed to fetch flake %q: %w", args.Flake, err)
+		}
+		log.Info("Exporting flake source from the Nix store", slog.String("url", metadata.LockedFlakeURL()), slog.String("path", metadata.Path), slog.String("dir", metadata.Dir()))
+		// The store path is the whole source tree, the flake may be in a subdirectory, e.g. github:owner/repo?dir=sub.
+		args.Code = filepath.Join(metadata.Path, filepath.FromSlash(metadata.Dir()))
+	}
+	if args.Rev != "" {
+		var cleanup func()
+		args.Code, cleanup, err = checkoutRev(log, args)
+		defer cleanup()
+		if err != nil {
+			return err
+		}
 	}
 
-	log.Info("Copying source code")
-	srcOutputDir := filepath.Join(nixExportPath, "source")
-	if err := os.MkdirAll(srcOutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create source output directory: %w", err)
+	flakes, err := getWorkspaceFlakes(args)
+	if err != nil {
+		return err
 	}
-	ignore := []string{".direnv", "nix-export", "nix-export.tar.gz", "result", "coverage.out", ".DS_Store"}
-	if err := os.CopyFS(srcOutputDir, newFilteredFS(os.DirFS(args.Code), ignore)); err != nil {
-		return fmt.Errorf("failed to copy source code: %w", err)
+
+	// Check the source code before the export, because building the flake can take a long time.
+	submodules := make([][]gitcmd.Submodule, len(flakes))
+	for i, f := range flakes {
+		flakeArgs := args
+		flakeArgs.Code = f.Code
+		if submodules[i], err = checkSource(log, flakeArgs); err != nil {
+			return err
+		}
+	}
+
+	if args.DryRun {
+		return dryRun(ctx, log, args, flakes, os.Stdout)
+	}
+
+	var basePaths map[string]struct{}
+	if len(args.Since) > 0 {
+		log.Info("Reading base exports", slog.Any("since", args.Since))
+		if basePaths, err = readBaseManifests(ctx, args.Since); err != nil {
+			return err
+		}
+	}
+
+	e, err := exportFlakes(ctx, log, args, nixExportPath, flakes, submodules)
+	if err != nil {
+		return err
+	}
+
+	if len(basePaths) > 0 && args.ExportNix {
+		log.Info("Removing store paths present in base exports", slog.Int("basePaths", len(basePaths)))
+		removed, err := removeBasePaths(ctx, log, filepath.Join(nixExportPath, "nix-store"), basePaths)
+		if err != nil {
+			return fmt.Errorf("failed to remove base paths: %w", err)
+		}
+		e.removePaths(basePaths)
+		if err = manifest.WritePaths(filepath.Join(nixExportPath, manifest.BaseFileName), slices.Sorted(maps.Keys(basePaths))); err != nil {
+			return fmt.Errorf("failed to write base manifest: %w", err)
+		}
+		log.Info("Removed store paths present in base exports", slog.Int("removed", removed))
 	}
 
 	log.Info("Collecting store paths")
-	if err = writeManifest(ctx, nixExportPath); err != nil {
+	if err = writeManifest(ctx, log, args, nixExportPath, e); err != nil {
 		return fmt.Errorf("failed to get store paths: %w", err)
 	}
 
@@ -104,10 +249,145 @@ func Run(ctx context.Context, log *slog.Logger, args Args) (err error) {
 	return nil
 }
 
-func exportNix(ctx context.Context, log *slog.Logger, args Args, nixExportPath string) (err error) {
+// exportedOutput is an output that was copied to the target store, and the store paths that were copied for it.
+type exportedOutput struct {
+	manifest.Output
+	Paths []string
+}
+
+// exported is the result of exporting Nix closures.
+type exported struct {
+	Outputs     []exportedOutput
+	FlakeInputs []string
+	Source      manifest.Source
+	// Flakes are the flakes of a workspace export.
+	Flakes []manifest.Flake
+	// PathFlakes maps the store paths of a workspace export to the names of the flakes that require them.
+	PathFlakes map[string][]string
+}
+
+// checkSource checks the source code of a flake before it's exported, and returns its git submodules.
+func checkSource(log *slog.Logger, args Args) (submodules []gitcmd.Submodule, err error) {
+	if args.RequireClean {
+		if err = requireClean(args); err != nil {
+			return nil, err
+		}
+	}
+	if isGitRepository(args.Code) {
+		log.Info("Checking git submodules and LFS files", slog.String("dir", args.Code))
+		return checkGit(log, args)
+	}
+	if args.GitBundle {
+		return nil, fmt.Errorf("git-bundle requires the source code to be in a git repository")
+	}
+	return nil, nil
+}
+
+// exportFlakes exports the Nix closures and source code of each flake. A single flake is exported to source/, while
+// the flakes of a workspace are exported to sources/<name>. All flakes share the nix-store, so store paths required
+// by more than one flake are only exported once.
+func exportFlakes(ctx context.Context, log *slog.Logger, args Args, nixExportPath string, flakes []workspaceFlake, submodules [][]gitcmd.Submodule) (e exported, err error) {
+	// Extra installables and paths don't belong to a flake, so they're only exported once.
+	extraJobs, err := getExtraJobs(args)
+	if err != nil {
+		return e, err
+	}
+	// Flakes in the same git repository share its bundles.
+	repoGitDirs := make(map[string]string)
+	writtenBundles := make(map[string]struct{})
+	for i, f := range flakes {
+		args := args
+		args.Code = f.Code
+		log := log
+		sourceDir := "source"
+		if f.Name != "" {
+			log = log.With(slog.String("flake", f.Name))
+			sourceDir = path.Join("sources", f.Name)
+		}
+
+		log.Info("Exporting Nix closures", slog.Any("systems", args.Systems))
+		fe, err := exportNix(ctx, log, args, nixExportPath, f.Name, extraJobs)
+		if err != nil {
+			return e, fmt.Errorf("failed to export Nix closures: %w", err)
+		}
+		extraJobs = nil
+
+		log.Info("Copying source code", slog.String("sourceFiles", args.SourceFiles))
+		if fe.Source, err = copySources(log, args, filepath.Join(nixExportPath, filepath.FromSlash(sourceDir))); err != nil {
+			return e, err
+		}
+
+		if args.GitBundle {
+			// git rev-parse --show-toplevel
+			repo, err := gitcmd.TopLevel(io.Discard, os.Stderr, args.Code)
+			if err != nil {
+				return e, fmt.Errorf("failed to get git repository: %w", err)
+			}
+			if _, ok := repoGitDirs[repo]; !ok {
+				repoGitDirs[repo] = path.Join("git", f.Name)
+			}
+			if fe.Source.GitBundles, err = writeGitBundles(log, repo, nixExportPath, repoGitDirs[repo], submodules[i], writtenBundles); err != nil {
+				return e, err
+			}
+		}
+		addProvenance(log, args, &fe.Source)
+
+		if f.Name == "" {
+			e = fe
+			continue
+		}
+		e.add(f.Name, fe)
+	}
+	return e, nil
+}
+
+// add the export of a workspace flake.
+func (e *exported) add(name string, fe exported) {
+	if e.PathFlakes == nil {
+		e.PathFlakes = make(map[string][]string)
+	}
+	addPath := func(p string) {
+		if !slices.Contains(e.PathFlakes[p], name) {
+			e.PathFlakes[p] = append(e.PathFlakes[p], name)
+		}
+	}
+	for _, o := range fe.Outputs {
+		if o.Flake == "" {
+			continue
+		}
+		for _, p := range o.Paths {
+			addPath(p)
+		}
+	}
+	for _, p := range fe.FlakeInputs {
+		addPath(p)
+	}
+	e.Outputs = append(e.Outputs, fe.Outputs...)
+	e.FlakeInputs = append(e.FlakeInputs, fe.FlakeInputs...)
+	slices.Sort(e.FlakeInputs)
+	e.FlakeInputs = slices.Compact(e.FlakeInputs)
+	e.Flakes = append(e.Flakes, manifest.Flake{Name: name, Source: fe.Source})
+}
+
+// removePaths removes the paths from the outputs and flake inputs.
+func (e *exported) removePaths(paths map[string]struct{}) {
+	contains := func(p string) bool {
+		_, ok := paths[p]
+		return ok
+	}
+	for i := range e.Outputs {
+		e.Outputs[i].Paths = slices.DeleteFunc(e.Outputs[i].Paths, contains)
+	}
+	e.FlakeInputs = slices.DeleteFunc(e.FlakeInputs, contains)
+}
+
+// exportNix builds the outputs of the flake in args.Code, and copies their closures to the nix-store of the export.
+// The flake name is empty unless the flake is part of a workspace. The extra jobs are exported alongside the outputs
+// of the flake.
+func exportNix(ctx context.Context, log *slog.Logger, args Args, nixExportPath, flake string, extraJobs []exportJob) (e exported, err error) {
 	if !args.ExportNix {
 		log.Info("Skipping Nix export")
-		return nil
+		return e, nil
 	}
 	// export NIXPKGS_COMMIT=`jq -r '.nodes.[.nodes.[.root].inputs.nixpkgs].locked | "\(.type):\(.owner)/\(.repo)/\(.rev)"' flake.lock`
 	// nix copy --to file://$PWD/export "$NIXPKGS_COMMIT#legacyPackages.x86_64-linux.bashInteractive"
@@ -129,154 +409,275 @@ func exportNix(ctx context.Context, log *slog.Logger, args Args, nixExportPath s
 		Path:   filepath.Join(nixExportPath, "nix-store"),
 	}).String()
 
-	op, err := nixcmd.FlakeShow(os.Stdout, os.Stderr, args.Code)
+	jobs, err := getJobs(log, args, flake)
 	if err != nil {
-		return fmt.Errorf("failed to gather nix outputs: %w", err)
-	}
-	drvs := op.Derivations(args.Architecture, args.Platform)
-
-	if ctx.Err() != nil {
-		log.Warn("Context cancelled, skipping build", slog.Any("outputs", drvs))
+		return e, err
 	}
+	jobs = append(jobs, extraJobs...)
 
-	log.Info("Building", slog.Any("outputs", drvs), slog.String("architecture", args.Architecture), slog.String("platform", args.Platform))
-
-	f, err := os.Open(filepath.Join(args.Code, "flake.lock"))
+	// Development environments are saved to profiles, which also stop them from being garbage collected until they've
+	// been copied.
+	profilesPath, err := os.MkdirTemp(getTemporaryPath(log, args.TemporaryPath), "flakegap-profiles")
 	if err != nil {
-		return fmt.Errorf("failed to open flake.lock: %w", err)
-	}
-	defer f.Close()
-	// export NIXPKGS_COMMIT=`jq -r '.nodes.[.nodes.[.root].inputs.nixpkgs].locked | "\(.type):\(.owner)/\(.repo)/\(.rev)"' flake.lock`
-	// nix copy --to file://$PWD/export "$NIXPKGS_COMMIT#legacyPackages.x86_64-linux.bashInteractive"
-	nixpkgsRef, err := nixcmd.GetNixpkgsReference(f)
-	if err != nil {
-		return fmt.Errorf("failed to get nixpkgs reference: %w", err)
-	}
-	suffixes := []string{
-		fmt.Sprintf("#legacyPackages.%s-%s.bashInteractive", args.Architecture, args.Platform), // Required for nix develop.
-	}
-	for _, suffix := range suffixes {
-		nixpkgsRefWithSuffix := nixpkgsRef + suffix
-		log.Info("Copying nixpkgs to target", slog.String("target", targetStore), slog.String("ref", nixpkgsRefWithSuffix))
-		realisedPathCount, err := nixcmd.CopyToAll(os.Stdout, os.Stderr, args.Code, targetStore, nixpkgsRefWithSuffix)
+		return e, fmt.Errorf("failed to create profiles dir: %w", err)
+	}
+	defer os.RemoveAll(profilesPath)
+
+	log.Info("Building", slog.Int("outputs", len(jobs)), slog.Int("jobs", args.Jobs), slog.String("closure", args.Closure))
+	e.Outputs = make([]exportedOutput, len(jobs))
+	roots := make(map[string][]string, len(jobs))
+	var rootsMutex sync.Mutex
+	var completed atomic.Int64
+	err = runJobs(ctx, args.Jobs, jobs, func(ctx context.Context, i int, job exportJob) error {
+		log := log.With(slog.String("system", job.System), slog.String("ref", job.Ref))
+		o, outputRoots, err := buildOutput(ctx, log, args, job, nixExportPath, profilesPath)
 		if err != nil {
-			return fmt.Errorf("failed to copy nixpkgs to %q: %w", targetStore, err)
+			return fmt.Errorf("failed to export %q: %w", job.Ref, err)
 		}
-		log.Info("Copied nixpkgs to target", slog.String("target", targetStore), slog.String("ref", nixpkgsRefWithSuffix), slog.Int("realisedPaths", realisedPathCount))
+		e.Outputs[i] = o
+		rootsMutex.Lock()
+		roots[job.Ref] = outputRoots
+		rootsMutex.Unlock()
+		log.Info("Built output", slog.Int64("item", completed.Add(1)), slog.Int("total", len(jobs)))
+		return nil
+	})
+	if err != nil {
+		return e, err
 	}
 
-	for i, ref := range drvs {
-		if ctx.Err() != nil {
-			log.Warn("Context cancelled, skipping build", slog.String("ref", ref))
-			return ctx.Err()
-		}
-		log.Info("Building", slog.String("ref", ref))
-		// nix build <ref>
-		if err := nixcmd.Build(os.Stdout, os.Stderr, args.Code, ref); err != nil {
-			log.Error("failed to build", slog.Any("error", err))
-			return fmt.Errorf("failed to build %q: %w", ref, err)
-		}
-		// nix copy --to file://$PWD/export .#packages.x86_64-linux.default
-		// nix copy --derivation --to file://$PWD/export .#packages.x86_64-linux.default
-		// nix copy --to file://$PWD/nix-export/nix-store `nix-store --realise $(nix path-info --recursive --derivation .#)`
-		log.Info("Copying Nix closures to target", slog.String("ref", ref), slog.String("target", targetStore))
-		realisedPathCount, err := nixcmd.CopyToAll(os.Stdout, os.Stderr, args.Code, targetStore, ref)
-		if err != nil {
-			return fmt.Errorf("failed to copy %q to %q: %w", ref, targetStore, err)
-		}
-		log.Info("Copied Nix closures to target", slog.String("ref", ref), slog.Int("realisedPaths", realisedPathCount))
-		targetDirParts := strings.Split(strings.TrimPrefix(ref, ".#"), ".")
-		target := filepath.Join(append([]string{nixExportPath, "outputs"}, targetDirParts...)...)
-		if err := os.MkdirAll(target, 0755); err != nil {
-			return fmt.Errorf("failed to create outputs directory %q: %w", target, err)
-		}
-		srcResultPath := filepath.Join(args.Code, "result")
-		evaluatedPath, err := filepath.EvalSymlinks(srcResultPath)
-		if err != nil {
-			return fmt.Errorf("failed to evaluate symlinks for %q: %w", srcResultPath, err)
-		}
-		fi, err := os.Stat(evaluatedPath)
-		if err != nil {
-			return fmt.Errorf("failed to stat evaluated result path %q: %w", evaluatedPath, err)
-		}
-		if !fi.IsDir() {
-			target = filepath.Join(target, "result")
-		}
-		log.Info("Copying build outputs to target", slog.String("ref", ref), slog.String("target", target))
-		if err := copyOutput(srcResultPath, evaluatedPath, target, fi); err != nil {
-			return fmt.Errorf("failed to copy output %q to %q: %w", srcResultPath, target, err)
-		}
-		log.Info("Completed operation", slog.String("ref", ref), slog.Int("item", i+1), slog.Int("total", len(drvs)))
+	log.Info("Copying Nix closures to target", slog.String("target", targetStore))
+	copyClosuresTo := nixcmd.CopyClosuresTo
+	if args.Closure == manifest.ClosureSources {
+		copyClosuresTo = nixcmd.CopySourcesTo
+	}
+	// nix copy --to file://$PWD/nix-export/nix-store `nix-store --realise $(nix path-info --recursive <drvs>)`
+	closures, err := copyClosuresTo(ctx, os.Stdout, os.Stderr, args.Code, targetStore, roots)
+	if err != nil {
+		return e, fmt.Errorf("failed to copy closures to %q: %w", targetStore, err)
+	}
+	for i := range e.Outputs {
+		e.Outputs[i].Paths = closures[e.Outputs[i].Installable]
+		log.Info("Copied Nix closure to target", slog.String("ref", e.Outputs[i].Installable), slog.Int("paths", len(e.Outputs[i].Paths)))
 	}
 
 	if ctx.Err() != nil {
 		log.Warn("Context cancelled, skipping flake archive")
-		return ctx.Err()
+		return e, ctx.Err()
 	}
 
 	log.Info("Copying flake archive to output")
 	// nix flake archive --to file:///nix-export/nix-store/
-	if err := nixcmd.FlakeArchive(os.Stdout, os.Stderr, args.Code, targetStore); err != nil {
+	if e.FlakeInputs, err = nixcmd.FlakeArchive(os.Stdout, os.Stderr, args.Code, targetStore); err != nil {
 		log.Error("failed to archive flake", slog.Any("error", err))
-		return fmt.Errorf("failed to archive flake: %w", err)
+		return e, fmt.Errorf("failed to archive flake: %w", err)
 	}
 	// End of the manually exported code.
-	return nil
+	return e, nil
 }
 
-type filteredFS struct {
-	fsys   fs.FS
-	ignore []string
+// getJobs returns the jobs required to export the outputs of the flake in args.Code for each system.
+func getJobs(log *slog.Logger, args Args, flake string) (jobs []exportJob, err error) {
+	filter, err := nixcmd.NewOutputFilter(args.Include, args.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := nixcmd.FlakeShow(os.Stdout, os.Stderr, args.Code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather nix outputs: %w", err)
+	}
+
+	// export NIXPKGS_COMMIT=`jq -r '.nodes.[.nodes.[.root].inputs.nixpkgs].locked | "\(.type):\(.owner)/\(.repo)/\(.rev)"' flake.lock`
+	// nix copy --to file://$PWD/export "$NIXPKGS_COMMIT#legacyPackages.x86_64-linux.bashInteractive"
+	nixpkgsInputs, err := getNixpkgsInputs(log, args.Code, args.Systems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nixpkgs inputs: %w", err)
+	}
+	if len(nixpkgsInputs) == 0 {
+		log.Warn("No flake inputs provide legacyPackages with bashInteractive, nix develop may not work offline")
+	}
+
+	for _, system := range args.Systems {
+		systemJobs, err := getSystemJobs(args, op, filter, nixpkgsInputs, system)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find outputs for %s: %w", system, err)
+		}
+		for i := range systemJobs {
+			systemJobs[i].Flake = flake
+		}
+		jobs = append(jobs, systemJobs...)
+	}
+	return jobs, nil
 }
 
-func newFilteredFS(fsys fs.FS, ignore []string) filteredFS {
-	return filteredFS{fsys: fsys, ignore: ignore}
+// exportJob is an output to build and copy to the target store.
+type exportJob struct {
+	// Flake is the name of the workspace flake that the output belongs to, if any.
+	Flake string
+	// System the output is built for, e.g. x86_64-linux.
+	System string
+	// Name of the output in the manifest.
+	Name string
+	// Ref is the installable to build and copy.
+	Ref string
+	// Reason the output is exported, e.g. flake-output.
+	Reason string
+	// CopyOutputs copies the build outputs to outputs/<system>/, or outputs/<flake>/<system>/ for workspace flakes.
+	CopyOutputs bool
+	// DevShell is set if the output is a devShell, which requires its development environment at runtime.
+	DevShell bool
 }
 
-func (f filteredFS) Open(name string) (fs.File, error) {
-	file, err := f.fsys.Open(name)
+// getSystemJobs returns the jobs required to export the outputs of a single Nix system, e.g. "x86_64-linux".
+func getSystemJobs(args Args, op nixcmd.FlakeShowOutput, filter nixcmd.OutputFilter, nixpkgsInputs []nixpkgsInput, system string) (jobs []exportJob, err error) {
+	attrs := []string{
+		fmt.Sprintf("legacyPackages.%s.bashInteractive", system), // Required for nix develop and nix shell.
+	}
+	for _, input := range nixpkgsInputs {
+		if !slices.Contains(input.Systems, system) {
+			continue
+		}
+		for _, attr := range attrs {
+			jobs = append(jobs, exportJob{
+				System: system,
+				Name:   input.Name + "#" + attr,
+				Ref:    input.Ref + "#" + attr,
+				Reason: manifest.ReasonNixpkgsInput,
+			})
+		}
+	}
+
+	installables, err := nixcmd.Installables(os.Stdout, os.Stderr, args.Code, op, filter, system)
 	if err != nil {
 		return nil, err
 	}
-	return &filteredFile{File: file, ignore: f.ignore}, nil
+	for _, installable := range installables {
+		jobs = append(jobs, exportJob{
+			System:      system,
+			Name:        installable.Attribute,
+			Ref:         installable.Ref,
+			Reason:      manifest.ReasonFlakeOutput,
+			CopyOutputs: true,
+			DevShell:    strings.HasPrefix(installable.Attribute, "devShells."),
+		})
+	}
+	return jobs, nil
 }
 
-func (f filteredFS) ReadLink(name string) (string, error) {
-	rl, ok := f.fsys.(fs.ReadLinkFS)
-	if !ok {
-		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+// buildOutput builds a single output, and copies its build outputs to outputs/<system>/.
+// The closure of the output is copied to the target store later, in a single batch with all other outputs. In build
+// mode, the roots of the closure are the derivations of the output, while in runtime mode they're the output paths, and
+// the development environment of devShells.
+func buildOutput(ctx context.Context, log *slog.Logger, args Args, job exportJob, nixExportPath, profilesPath string) (o exportedOutput, roots []string, err error) {
+	o.Output = manifest.Output{
+		Name:        job.Name,
+		Flake:       job.Flake,
+		System:      job.System,
+		Installable: job.Ref,
+		Reason:      job.Reason,
+		StorePaths:  make(map[string]string),
+	}
+
+	// Jobs run concurrently, so nix output is logged through the job's logger to tag it with the output it belongs to.
+	stdout, stderr := newLogWriter(log, slog.LevelInfo), newLogWriter(log, slog.LevelError)
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	if args.Closure == manifest.ClosureSources {
+		roots, err = evalOutput(ctx, stdout, stderr, log, args, job, &o)
+		return o, roots, err
+	}
+
+	log.Info("Building")
+	// nix build --no-link --json <ref>
+	results, err := nixcmd.Build(ctx, stdout, stderr, args.Code, job.Ref)
+	if err != nil {
+		log.Error("failed to build", slog.Any("error", err))
+		return o, nil, fmt.Errorf("failed to build %q: %w", job.Ref, err)
 	}
-	return rl.ReadLink(name)
-}
 
-type filteredFile struct {
-	fs.File
-	ignore []string
+	target := outputPath(nixExportPath, job.Flake, job.System, job.Name)
+	for _, result := range results {
+		maps.Copy(o.StorePaths, result.Outputs)
+		if result.DrvPath != "" && args.Closure == manifest.ClosureBuild {
+			roots = append(roots, result.DrvPath)
+		} else {
+			roots = append(roots, slices.Collect(maps.Values(result.Outputs))...)
+		}
+		if !job.CopyOutputs {
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(result.Outputs)) {
+			// Name additional outputs in the same way as nix build names its result-<output> symlinks.
+			outputTarget := target
+			if name != "out" {
+				outputTarget += "-" + name
+			}
+			log.Info("Copying build outputs to target", slog.String("output", name), slog.String("target", outputTarget))
+			if err := copyOutput(result.Outputs[name], outputTarget); err != nil {
+				return o, nil, fmt.Errorf("failed to copy output %q to %q: %w", result.Outputs[name], outputTarget, err)
+			}
+		}
+	}
+
+	if job.DevShell && args.Closure == manifest.ClosureRuntime {
+		log.Info("Saving development environment")
+		// nix develop --profile <profile> <ref> --command true
+		profile := filepath.Join(profilesPath, job.Name)
+		if o.Environment, err = nixcmd.DevelopProfile(ctx, stdout, stderr, args.Code, profile, job.Ref); err != nil {
+			return o, nil, fmt.Errorf("failed to save development environment of %q: %w", job.Ref, err)
+		}
+		roots = append(roots, o.Environment)
+	}
+	return o, roots, nil
 }
 
-func (f *filteredFile) ReadDir(n int) (entries []fs.DirEntry, err error) {
-	dir, ok := f.File.(fs.ReadDirFile)
-	if !ok {
-		return nil, &fs.PathError{Op: "readdir", Path: ".", Err: errors.New("not a directory")}
+// evalOutput finds the derivations of a single output without building it, for sources exports, where the outputs
+// are rebuilt from source on the target.
+func evalOutput(ctx context.Context, stdout, stderr io.Writer, log *slog.Logger, args Args, job exportJob, o *exportedOutput) (roots []string, err error) {
+	log.Info("Evaluating derivations")
+	// nix path-info --derivation <ref>
+	roots, err = nixcmd.PathInfo(ctx, stdout, stderr, args.Code, false, true, job.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate derivations of %q: %w", job.Ref, err)
 	}
-	all, err := dir.ReadDir(n)
+	// nix derivation show <drvs>
+	drvs, err := nixcmd.DerivationShow(ctx, stdout, stderr, args.Code, roots...)
 	if err != nil {
-		return all, err
+		return nil, fmt.Errorf("failed to get outputs of %q: %w", job.Ref, err)
 	}
-	entries = make([]fs.DirEntry, 0, len(all))
-	for _, e := range all {
-		if !slices.Contains(f.ignore, e.Name()) {
-			entries = append(entries, e)
+	for _, drv := range drvs {
+		for name, output := range drv.Outputs {
+			o.StorePaths[name] = output.Path
 		}
 	}
-	return entries, nil
+	return roots, nil
 }
 
-func copyOutput(srcPath, evaluatedPath, target string, fi os.FileInfo) error {
+// outputPath returns the directory within outputs/<system>/ that the build output of the attribute is copied to.
+// The system is removed from the attribute path, so packages.x86_64-linux.default is written to
+// outputs/x86_64-linux/packages/default. The outputs of workspace flakes are written to outputs/<flake>/<system>/.
+func outputPath(nixExportPath, flake, system, attr string) string {
+	parts := strings.Split(attr, ".")
+	if i := slices.Index(parts, system); i >= 0 {
+		parts = slices.Delete(parts, i, i+1)
+	}
+	return filepath.Join(append([]string{nixExportPath, "outputs", filepath.FromSlash(flake), system}, parts...)...)
+}
+
+// copyOutput copies the store path to the target directory. If the store path is a file, it's copied to target/result.
+func copyOutput(storePath, target string) error {
+	fi, err := os.Stat(storePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat output path %q: %w", storePath, err)
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("failed to create outputs directory %q: %w", target, err)
+	}
 	if !fi.IsDir() {
-		return copyFile(evaluatedPath, target)
+		return copyFile(storePath, filepath.Join(target, "result"))
 	}
-	return os.CopyFS(target, os.DirFS(srcPath))
+	return os.CopyFS(target, os.DirFS(storePath))
 }
 
 func copyFile(src, dst string) (err error) {
@@ -303,38 +704,88 @@ func copyFile(src, dst string) (err error) {
 	return err
 }
 
-func writeManifest(ctx context.Context, nixExportPath string) (err error) {
-	exportManifestFileName := filepath.Join(nixExportPath, "nix-export.txt")
+func writeManifest(ctx context.Context, log *slog.Logger, args Args, nixExportPath string, e exported) (err error) {
+	pathOutputs := make(map[string][]string)
+	systemPaths := make(map[string][]string)
+	m := manifest.Manifest{
+		Version:     manifest.Version,
+		Created:     time.Now().UTC(),
+		Flakegap:    args.Version,
+		Systems:     args.Systems,
+		Closure:     args.Closure,
+		Include:     args.Include,
+		Exclude:     args.Exclude,
+		Outputs:     []manifest.Output{},
+		FlakeInputs: e.FlakeInputs,
+		Source:      e.Source,
+		Flakes:      e.Flakes,
+		Paths:       []manifest.Path{},
+	}
+	for _, o := range e.Outputs {
+		m.Outputs = append(m.Outputs, o.Output)
+		for _, p := range o.Paths {
+			if !slices.Contains(pathOutputs[p], o.Name) {
+				pathOutputs[p] = append(pathOutputs[p], o.Name)
+			}
+		}
+		if o.System != "" {
+			systemPaths[o.System] = append(systemPaths[o.System], o.Paths...)
+		}
+	}
+	for system, paths := range systemPaths {
+		slices.Sort(paths)
+		if err = manifest.WritePaths(filepath.Join(nixExportPath, manifest.SystemFileName(system)), slices.Compact(paths)); err != nil {
+			return fmt.Errorf("failed to write %s manifest: %w", system, err)
+		}
+	}
+
+	if m.ID, err = manifest.NewID(); err != nil {
+		return err
+	}
+	if m.Nix, err = nixcmd.Version(os.Stdout, os.Stderr); err != nil {
+		log.Warn("Failed to get Nix version", slog.Any("error", err))
+	}
+
+	exportManifestFileName := filepath.Join(nixExportPath, manifest.FileName)
 	w, err := os.Create(exportManifestFileName)
 	if err != nil {
 		return fmt.Errorf("failed to create manifest file: %w", err)
 	}
 	defer w.Close()
 
-	return filepath.WalkDir(nixExportPath, func(path string, d os.DirEntry, err error) error {
-		if cancel := ctx.Err(); cancel != nil {
-			return cancel
-		}
-		if err != nil {
-			return err
-		}
-
-		if filepath.Ext(path) != ".narinfo" || d.IsDir() {
-			return nil
-		}
-
-		r, err := os.Open(path)
-		if err != nil {
-			return fmt.Errorf("failed to open %q: %w", path, err)
-		}
-		defer r.Close()
-		ni, err := narinfo.Parse(r)
-		if err != nil {
-			return fmt.Errorf("failed to parse narinfo %q: %w", path, err)
-		}
+	err = manifest.WalkNarInfos(ctx, nixExportPath, func(fileName string, ni *narinfo.NarInfo) error {
 		if _, err = fmt.Fprintf(w, "%s\n", ni.StorePath); err != nil {
 			return fmt.Errorf("failed to write store path %q: %w", ni.StorePath, err)
 		}
+		m.Paths = append(m.Paths, newManifestPath(ni, pathOutputs[ni.StorePath], e.PathFlakes[ni.StorePath]))
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(m.Paths, func(a, b manifest.Path) int {
+		return strings.Compare(a.StorePath, b.StorePath)
+	})
+
+	return manifest.Write(filepath.Join(nixExportPath, manifest.JSONFileName), m)
+}
+
+func newManifestPath(ni *narinfo.NarInfo, outputs, flakes []string) (p manifest.Path) {
+	storeDir := path.Dir(ni.StorePath)
+	p = manifest.Path{
+		StorePath: ni.StorePath,
+		NarSize:   ni.NarSize,
+		Outputs:   outputs,
+		Flakes:    flakes,
+	}
+	if ni.NarHash != nil {
+		p.NarHash = ni.NarHash.String()
+	}
+	for _, ref := range ni.References {
+		p.References = append(p.References, path.Join(storeDir, ref))
+	}
+	if ni.Deriver != "" {
+		p.Deriver = path.Join(storeDir, ni.Deriver)
+	}
+	return p
 }
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/a-h/flakegap/manifest"
+)
+
+// nixStoreDir is the directory of the Nix store that extra paths must be within.
+const nixStoreDir = "/nix/store"
+
+// getExtraJobs returns the jobs that export the extra installables and store paths.
+// Extra installables, such as nixpkgs#git, are built for the host system.
+func getExtraJobs(args Args) (jobs []exportJob, err error) {
+	for _, installable := range args.ExtraInstallables {
+		jobs = append(jobs, exportJob{
+			Name:   installable,
+			Ref:    installable,
+			Reason: manifest.ReasonExtraInstallable,
+		})
+	}
+	for _, p := range args.ExtraPaths {
+		storePath, err := getStorePath(p)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, exportJob{
+			Name:   storePath,
+			Ref:    storePath,
+			Reason: manifest.ReasonExtraPath,
+		})
+	}
+	return jobs, nil
+}
+
+// getStorePath returns the top-level store path that p is, or is within, after following symlinks, so that profiles
+// such as ~/.nix-profile, and files such as /nix/store/<hash>-git/bin/git can be exported.
+func getStorePath(p string) (storePath string, err error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return storePath, fmt.Errorf("failed to resolve extra path %q: %w", p, err)
+	}
+	rel, err := filepath.Rel(nixStoreDir, resolved)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return storePath, fmt.Errorf("extra path %q resolves to %q, which is not in %s", p, resolved, nixStoreDir)
+	}
+	name, _, _ := strings.Cut(rel, string(filepath.Separator))
+	return filepath.Join(nixStoreDir, name), nil
+}
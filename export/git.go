@@ -0,0 +1,188 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/a-h/flakegap/gitcmd"
+)
+
+const (
+	// GitMissingWarn logs a warning when submodules or LFS files are missing from the working tree.
+	GitMissingWarn = "warn"
+	// GitMissingFail stops the export when submodules or LFS files are missing from the working tree.
+	GitMissingFail = "fail"
+)
+
+// isGitRepository returns true if codeDir is within a git repository.
+func isGitRepository(codeDir string) bool {
+	_, err := gitcmd.Revision(io.Discard, io.Discard, codeDir)
+	return err == nil
+}
+
+// checkGit checks that the submodules and Git LFS files of the source code are present in the working tree, since the
+// working tree is what's copied to the export. Uninitialised submodules are empty directories, and LFS files that
+// haven't been pulled are pointer files, so flakes that use them can't be built on the other side of the airgap.
+//
+// Only the submodules within the directories that are copied to the export are checked and returned, with their paths
+// relative to the root of the repository.
+func checkGit(log *slog.Logger, args Args) (submodules []gitcmd.Submodule, err error) {
+	if submodules, err = getSourceSubmodules(args.Code); err != nil {
+		return nil, err
+	}
+	var missing []error
+	for _, sm := range submodules {
+		if !sm.Initialised {
+			missing = append(missing, fmt.Errorf("submodule %q is not initialised, run git submodule update --init --recursive", sm.Path))
+			continue
+		}
+		if sm.Conflict {
+			missing = append(missing, fmt.Errorf("submodule %q has merge conflicts", sm.Path))
+			continue
+		}
+		if sm.Modified {
+			log.Warn("Submodule checked out commit does not match the commit recorded in the repository", slog.String("path", sm.Path), slog.String("commit", sm.Commit))
+		}
+	}
+
+	// git ls-files -z ':(attr:filter=lfs)'
+	lfsFiles, err := gitcmd.LFSFiles(io.Discard, os.Stderr, args.Code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Git LFS files: %w", err)
+	}
+	for _, name := range lfsFiles {
+		pointer, err := isLFSPointerFile(filepath.Join(args.Code, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		if pointer {
+			missing = append(missing, fmt.Errorf("LFS file %q has not been pulled, run git lfs pull", name))
+		}
+	}
+
+	if len(missing) == 0 {
+		return submodules, nil
+	}
+	if args.GitMissing == GitMissingFail {
+		return nil, errors.Join(missing...)
+	}
+	for _, err := range missing {
+		log.Warn("Source code is incomplete", slog.Any("error", err))
+	}
+	return submodules, nil
+}
+
+// getSourceSubmodules returns the submodules of the git repository that contains codeDir that are within the
+// directories copied to export the flake in codeDir.
+func getSourceSubmodules(codeDir string) (submodules []gitcmd.Submodule, err error) {
+	// git rev-parse --show-toplevel
+	repo, err := gitcmd.TopLevel(io.Discard, os.Stderr, codeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git repository: %w", err)
+	}
+	// git submodule status --recursive
+	all, err := gitcmd.Submodules(io.Discard, os.Stderr, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submodules: %w", err)
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	abs, err := filepath.Abs(codeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute source path: %w", err)
+	}
+	dirs, _, err := getSourceDirs(abs)
+	if err != nil {
+		return nil, err
+	}
+	// git resolves symlinks in the path of the repository, e.g. /tmp to /private/tmp on macOS.
+	if repo, err = filepath.EvalSymlinks(repo); err != nil {
+		return nil, fmt.Errorf("failed to resolve git repository path: %w", err)
+	}
+	relDirs := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if dir, err = filepath.EvalSymlinks(dir); err != nil {
+			return nil, fmt.Errorf("failed to resolve source path: %w", err)
+		}
+		rel, err := filepath.Rel(repo, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get path of %q within git repository: %w", dir, err)
+		}
+		relDirs[i] = filepath.ToSlash(rel)
+	}
+	return filterSubmodules(all, relDirs)
+}
+
+// filterSubmodules returns the submodules within the slash separated dirs, which are relative to the root of the
+// repository. Submodule paths must be within the repository.
+func filterSubmodules(all []gitcmd.Submodule, dirs []string) (submodules []gitcmd.Submodule, err error) {
+	for _, sm := range all {
+		if path.IsAbs(sm.Path) || slices.Contains(strings.Split(sm.Path, "/"), "..") {
+			return nil, fmt.Errorf("submodule path %q is not within the git repository", sm.Path)
+		}
+		within := slices.ContainsFunc(dirs, func(dir string) bool {
+			return dir == "." || sm.Path == dir || strings.HasPrefix(sm.Path, dir+"/")
+		})
+		if within {
+			submodules = append(submodules, sm)
+		}
+	}
+	return submodules, nil
+}
+
+func isLFSPointerFile(fileName string) (pointer bool, err error) {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open Git LFS file %q: %w", fileName, err)
+	}
+	defer f.Close()
+	return gitcmd.IsLFSPointer(f)
+}
+
+// writeGitBundles writes a git bundle of the repository at repo, and of each initialised submodule, to gitDir in the
+// export, e.g. git/, so that the history of the source code is available on the other side of the airgap. Submodule
+// bundles are named after the path of the submodule within the repository, e.g. git/submodules/vendor/lib.bundle.
+// Bundles in written have already been written by another flake in the same repository, so they're not written again.
+// It returns the slash separated paths of the bundles, relative to the export.
+func writeGitBundles(log *slog.Logger, repo, nixExportPath, gitDir string, submodules []gitcmd.Submodule, written map[string]struct{}) (bundles []string, err error) {
+	write := func(dir, name string) error {
+		bundles = append(bundles, name)
+		if _, ok := written[name]; ok {
+			return nil
+		}
+		written[name] = struct{}{}
+		fileName := filepath.Join(nixExportPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			return fmt.Errorf("failed to create git bundle directory: %w", err)
+		}
+		log.Info("Writing git bundle", slog.String("dir", dir), slog.String("bundle", name))
+		// git bundle create <fileName> --all
+		if err := gitcmd.Bundle(io.Discard, os.Stderr, dir, fileName); err != nil {
+			return fmt.Errorf("failed to write git bundle of %q: %w", dir, err)
+		}
+		return nil
+	}
+	if err = write(repo, path.Join(gitDir, "repo.bundle")); err != nil {
+		return nil, err
+	}
+	for _, sm := range submodules {
+		if !sm.Initialised {
+			continue
+		}
+		if err = write(filepath.Join(repo, filepath.FromSlash(sm.Path)), path.Join(gitDir, "submodules", sm.Path+".bundle")); err != nil {
+			return nil, err
+		}
+	}
+	return bundles, nil
+}
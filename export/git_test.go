@@ -0,0 +1,65 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/a-h/flakegap/gitcmd"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterSubmodules(t *testing.T) {
+	all := []gitcmd.Submodule{
+		{Path: "vendor/lib"},
+		{Path: "nix/deps/a"},
+		{Path: "nix-tools"},
+		{Path: "shared"},
+	}
+	tests := []struct {
+		name     string
+		dirs     []string
+		expected []string
+	}{
+		{
+			name:     "the repository root includes every submodule",
+			dirs:     []string{"."},
+			expected: []string{"vendor/lib", "nix/deps/a", "nix-tools", "shared"},
+		},
+		{
+			name:     "a flake in a subdirectory includes only submodules within it",
+			dirs:     []string{"nix"},
+			expected: []string{"nix/deps/a"},
+		},
+		{
+			name:     "path inputs outside the flake include their submodules",
+			dirs:     []string{"nix", "shared"},
+			expected: []string{"nix/deps/a", "shared"},
+		},
+		{
+			name:     "no submodules within the dirs",
+			dirs:     []string{"docs"},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submodules, err := filterSubmodules(all, tt.dirs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var paths []string
+			for _, sm := range submodules {
+				paths = append(paths, sm.Path)
+			}
+			if diff := cmp.Diff(tt.expected, paths); diff != "" {
+				t.Errorf("unexpected submodules (-want +got):\n%s", diff)
+			}
+		})
+	}
+	t.Run("paths outside the repository are rejected", func(t *testing.T) {
+		for _, p := range []string{"../vendor/lib", "/vendor/lib", "vendor/../../lib"} {
+			if _, err := filterSubmodules([]gitcmd.Submodule{{Path: p}}, []string{"."}); err == nil {
+				t.Errorf("expected an error for submodule path %q", p)
+			}
+		}
+	})
+}
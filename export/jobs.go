@@ -0,0 +1,79 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// runJobs calls fn for each job, running up to n jobs concurrently.
+// The first job to fail cancels the context passed to the remaining jobs, and its error is returned.
+func runJobs[T any](ctx context.Context, n int, jobs []T, fn func(ctx context.Context, i int, job T) error) (err error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	sem := make(chan struct{}, max(n, 1))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			if err := fn(ctx, i, job); err != nil {
+				cancel(err)
+			}
+		})
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// logWriter logs each line written to it through log, so that the output of commands run by concurrent jobs is tagged
+// with the job that it belongs to. Lines that aren't terminated are logged by Flush.
+type logWriter struct {
+	log   *slog.Logger
+	level slog.Level
+	m     sync.Mutex
+	buf   []byte
+}
+
+func newLogWriter(log *slog.Logger, level slog.Level) *logWriter {
+	return &logWriter{log: log, level: level}
+}
+
+func (lw *logWriter) Write(p []byte) (n int, err error) {
+	lw.m.Lock()
+	defer lw.m.Unlock()
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lw.logLine(lw.buf[:i])
+		lw.buf = lw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs any remaining output that isn't terminated by a newline.
+func (lw *logWriter) Flush() {
+	lw.m.Lock()
+	defer lw.m.Unlock()
+	lw.logLine(lw.buf)
+	lw.buf = nil
+}
+
+func (lw *logWriter) logLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+	lw.log.Log(context.Background(), lw.level, string(line))
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunJobs(t *testing.T) {
+	t.Run("all jobs are run", func(t *testing.T) {
+		jobs := []int{1, 2, 3, 4, 5}
+		results := make([]int, len(jobs))
+		err := runJobs(context.Background(), 2, jobs, func(ctx context.Context, i int, job int) error {
+			results[i] = job * 2
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, job := range jobs {
+			if results[i] != job*2 {
+				t.Errorf("job %d: expected %d, got %d", i, job*2, results[i])
+			}
+		}
+	})
+	t.Run("concurrency is limited", func(t *testing.T) {
+		var running, maxRunning atomic.Int64
+		err := runJobs(context.Background(), 3, make([]int, 20), func(ctx context.Context, i int, job int) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if maxRunning.Load() > 3 {
+			t.Errorf("expected at most 3 concurrent jobs, got %d", maxRunning.Load())
+		}
+	})
+	t.Run("the first error cancels the remaining jobs", func(t *testing.T) {
+		expectedErr := errors.New("failed")
+		var started atomic.Int64
+		err := runJobs(context.Background(), 1, make([]int, 10), func(ctx context.Context, i int, job int) error {
+			started.Add(1)
+			if i == 2 {
+				return expectedErr
+			}
+			return nil
+		})
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("expected %v, got %v", expectedErr, err)
+		}
+		if started.Load() != 3 {
+			t.Errorf("expected 3 jobs to start, got %d", started.Load())
+		}
+	})
+}
+
+func TestLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})).With(slog.String("ref", ".#default"))
+	w := newLogWriter(log, slog.LevelError)
+	w.Write([]byte("error: build of\r\n"))
+	w.Write([]byte("\n  failed"))
+	w.Write([]byte(" with exit code 1\nlast"))
+	w.Flush()
+	w.Flush()
+
+	expected := `level=ERROR msg="error: build of" ref=.#default
+level=ERROR msg="  failed with exit code 1" ref=.#default
+level=ERROR msg=last ref=.#default
+`
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected log output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/flakegap/nixcmd"
+)
+
+// nixpkgsInput is a flake input that provides legacyPackages with bashInteractive, such as nixpkgs or nixpkgs-unstable.
+type nixpkgsInput struct {
+	// Name is the input path, e.g. nixpkgs, or nix/nixpkgs for the nixpkgs input of the nix input.
+	Name string
+	// Ref is the locked flake reference of the input.
+	Ref string
+	// Systems that the input provides legacyPackages.<system>.bashInteractive for.
+	Systems []string
+}
+
+// bashInteractiveSystemsExpr returns a Nix function of the outputs of a flake that returns the systems of
+// legacyPackages that provide bashInteractive, out of the given systems. Flakes without legacyPackages return an empty
+// list, so that evaluation errors are only returned for inputs that can't be evaluated. Other flakes can provide
+// legacyPackages too, so the attribute is checked, rather than assuming that every input with legacyPackages is nixpkgs.
+func bashInteractiveSystemsExpr(systems []string) string {
+	quoted := make([]string, len(systems))
+	for i, system := range systems {
+		quoted[i] = strconv.Quote(system)
+	}
+	return fmt.Sprintf(`outputs: if !(outputs ? legacyPackages) then [ ] else let lp = outputs.legacyPackages; in builtins.filter (s: lp ? ${s} && (builtins.tryEval (lp.${s} ? bashInteractive)).value) [ %s ]`, strings.Join(quoted, " "))
+}
+
+// getNixpkgsInputs finds every input in the flake.lock file, including inputs of inputs, that provides
+// legacyPackages.<system>.bashInteractive for any of the systems. Inputs that follow other inputs are resolved, so each
+// locked input is only returned once.
+func getNixpkgsInputs(log *slog.Logger, codeDir string, systems []string) (inputs []nixpkgsInput, err error) {
+	f, err := os.Open(filepath.Join(codeDir, "flake.lock"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open flake.lock: %w", err)
+	}
+	defer f.Close()
+	l, err := nixcmd.ReadFlakeLock(f)
+	if err != nil {
+		return nil, err
+	}
+	lockedInputs, err := l.Inputs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve flake inputs: %w", err)
+	}
+
+	var refs []string
+	for _, input := range lockedInputs {
+		if !l.Nodes[input.Node].IsFlake() {
+			continue
+		}
+		ref, err := l.Ref(input.Node)
+		if err != nil {
+			log.Warn("Skipping flake input with unsupported lock", slog.String("input", input.Name()), slog.Any("error", err))
+			continue
+		}
+		if slices.Contains(refs, ref) {
+			continue
+		}
+		refs = append(refs, ref)
+		// nix eval --json <ref>#. --apply 'outputs: if !(outputs ? legacyPackages) then [ ] else ...'
+		inputSystems, err := nixcmd.EvalJSON[[]string](io.Discard, os.Stderr, codeDir, ref+"#.", bashInteractiveSystemsExpr(systems))
+		if err != nil {
+			log.Warn("Failed to evaluate flake input, skipping", slog.String("input", input.Name()), slog.Any("error", err))
+			continue
+		}
+		if len(inputSystems) == 0 {
+			log.Debug("Flake input does not provide bashInteractive", slog.String("input", input.Name()))
+			continue
+		}
+		log.Info("Found nixpkgs input", slog.String("input", input.Name()), slog.String("ref", ref), slog.Any("systems", inputSystems))
+		inputs = append(inputs, nixpkgsInput{
+			Name:    input.Name(),
+			Ref:     ref,
+			Systems: inputSystems,
+		})
+	}
+	return inputs, nil
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/a-h/flakegap/gitcmd"
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+)
+
+// checkoutRev checks out args.Rev to a temporary git worktree, so that a commit can be exported without changing the
+// working directory. It returns the directory of the flake within the worktree, and a function that removes the
+// worktree.
+func checkoutRev(log *slog.Logger, args Args) (codeDir string, cleanup func(), err error) {
+	cleanup = func() {}
+	// git rev-parse --show-prefix
+	prefix, err := gitcmd.Prefix(io.Discard, os.Stderr, args.Code)
+	if err != nil {
+		return codeDir, cleanup, fmt.Errorf("rev requires the source code to be in a git repository: %w", err)
+	}
+	tempDir, err := os.MkdirTemp(getTemporaryPath(log, args.TemporaryPath), "flakegap-worktree")
+	if err != nil {
+		return codeDir, cleanup, fmt.Errorf("failed to create worktree dir: %w", err)
+	}
+	worktree := filepath.Join(tempDir, "source")
+	cleanup = func() {
+		// git worktree remove --force <worktree>
+		if err := gitcmd.WorktreeRemove(io.Discard, os.Stderr, args.Code, worktree); err != nil {
+			log.Warn("Failed to remove git worktree", slog.String("worktree", worktree), slog.Any("error", err))
+		}
+		os.RemoveAll(tempDir)
+	}
+
+	log.Info("Checking out revision to temporary worktree", slog.String("rev", args.Rev), slog.String("worktree", worktree))
+	// git worktree add --detach <worktree> <rev>
+	if err = gitcmd.WorktreeAdd(io.Discard, os.Stderr, args.Code, worktree, args.Rev); err != nil {
+		os.RemoveAll(tempDir)
+		return codeDir, func() {}, fmt.Errorf("failed to check out %q: %w", args.Rev, err)
+	}
+	submodules, err := gitcmd.Submodules(io.Discard, os.Stderr, worktree)
+	if err != nil {
+		return codeDir, cleanup, fmt.Errorf("failed to get submodules: %w", err)
+	}
+	if len(submodules) > 0 {
+		log.Info("Checking out submodules", slog.Int("submodules", len(submodules)))
+		// git submodule update --init --recursive
+		if err = gitcmd.SubmoduleUpdate(io.Discard, os.Stderr, worktree); err != nil {
+			return codeDir, cleanup, fmt.Errorf("failed to check out submodules: %w", err)
+		}
+	}
+	return filepath.Join(worktree, filepath.FromSlash(prefix)), cleanup, nil
+}
+
+// requireClean returns an error if the source code has uncommitted changes, or isn't in a git repository.
+func requireClean(args Args) error {
+	if !isGitRepository(args.Code) {
+		return fmt.Errorf("require-clean requires the source code to be in a git repository")
+	}
+	// Untracked files that are not ignored are exported in gitignore mode, so they're uncommitted changes too.
+	// git status --porcelain --untracked-files=normal
+	// In git mode, only tracked files are exported.
+	// git status --porcelain --untracked-files=no
+	dirty, err := gitcmd.IsDirty(io.Discard, os.Stderr, args.Code, args.SourceFiles == SourceFilesGitignore)
+	if err != nil {
+		return fmt.Errorf("failed to get git status: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("source code has uncommitted changes, commit or stash them, or export a commit with -rev")
+	}
+	return nil
+}
+
+// addProvenance records where the source code came from: its git revision, branch and dirty status, and the locked
+// URL and narHash that Nix resolves the flake to. Flakes exported with -flake are not git repositories, so their
+// revision is taken from the flake metadata.
+func addProvenance(log *slog.Logger, args Args, source *manifest.Source) {
+	source.Rev = args.Rev
+	source.FlakeRef = args.Flake
+	ref := "."
+	if args.Flake != "" {
+		ref = args.Flake
+	} else {
+		addGitProvenance(log, args, source)
+	}
+	if lock, err := os.ReadFile(filepath.Join(args.Code, "flake.lock")); err == nil {
+		source.FlakeLock = lock
+	}
+	// nix flake metadata --json <ref>
+	metadata, err := nixcmd.FlakeMetadata(io.Discard, os.Stderr, args.Code, ref)
+	if err != nil {
+		log.Warn("Failed to get flake metadata", slog.Any("error", err))
+		return
+	}
+	if args.Flake != "" {
+		source.Revision = metadata.Revision
+	}
+	source.Flake = &manifest.FlakeMetadata{
+		URL:          metadata.LockedFlakeURL(),
+		NarHash:      metadata.Locked.NarHash,
+		StorePath:    metadata.Path,
+		LastModified: metadata.LastModified,
+	}
+}
+
+func addGitProvenance(log *slog.Logger, args Args, source *manifest.Source) {
+	var err error
+	if source.Revision, err = gitcmd.Revision(io.Discard, io.Discard, args.Code); err != nil {
+		log.Warn("Source code is not a git repository, the revision will not be recorded", slog.Any("error", err))
+		return
+	}
+	if source.Branch, err = gitcmd.Branch(io.Discard, io.Discard, args.Code); err != nil {
+		log.Warn("Failed to get git branch", slog.Any("error", err))
+	}
+	if source.Dirty, err = gitcmd.IsDirty(io.Discard, io.Discard, args.Code, args.SourceFiles == SourceFilesGitignore); err != nil {
+		log.Warn("Failed to get git status", slog.Any("error", err))
+	}
+	if source.Dirty {
+		log.Warn("Source code has uncommitted changes, use -require-clean to prevent exporting them")
+	}
+}
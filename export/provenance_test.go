@@ -0,0 +1,66 @@
+package export
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = dir
+	if op, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, op)
+	}
+}
+
+func TestCheckoutRev(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found on path")
+	}
+	repo := t.TempDir()
+	flakeDir := filepath.Join(repo, "nix")
+	if err := os.MkdirAll(flakeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	flakeFileName := filepath.Join(flakeDir, "flake.nix")
+	if err := os.WriteFile(flakeFileName, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "init", "--quiet")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "--quiet", "-m", "v1")
+	runGit(t, repo, "tag", "v1")
+	if err := os.WriteFile(flakeFileName, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "commit", "--quiet", "-am", "v2")
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	codeDir, cleanup, err := checkoutRev(log, Args{Code: flakeDir, Rev: "v1", TemporaryPath: t.TempDir()})
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to check out rev: %v", err)
+	}
+	// The flake is in the same directory within the worktree as within the repository.
+	content, err := os.ReadFile(filepath.Join(codeDir, "flake.nix"))
+	if err != nil {
+		t.Fatalf("failed to read flake.nix from the worktree: %v", err)
+	}
+	if string(content) != "v1" {
+		t.Errorf("expected flake.nix at v1, got %q", content)
+	}
+	// The working directory is unchanged.
+	if content, _ = os.ReadFile(flakeFileName); string(content) != "v2" {
+		t.Errorf("expected the working directory to be unchanged, got %q", content)
+	}
+
+	cleanup()
+	if _, err = os.Stat(codeDir); !os.IsNotExist(err) {
+		t.Errorf("expected the worktree to be removed, got %v", err)
+	}
+}
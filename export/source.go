@@ -0,0 +1,379 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/a-h/flakegap/gitcmd"
+	"github.com/a-h/flakegap/gitignore"
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+)
+
+const (
+	// SourceFilesGitignore copies the source files that are not ignored by .gitignore and .flakegapignore files.
+	SourceFilesGitignore = "gitignore"
+	// SourceFilesGit copies the source files that are tracked by git, which are the files Nix sees as the flake source.
+	SourceFilesGit = "git"
+)
+
+// ignoreFileNames are the ignore files that are read from each directory of the source code, in order of precedence.
+var ignoreFileNames = []string{".gitignore", ".flakegapignore"}
+
+// defaultIgnore are the patterns that are always ignored in gitignore mode.
+var defaultIgnore = []string{".direnv", "nix-export", "nix-export.tar.gz", "result", "coverage.out", ".DS_Store"}
+
+// copySources copies the source code of the flake, and of its path inputs that are outside of the flake directory, to
+// dst. The relative layout of the directories is kept, so if the flake has a path:../shared input, the flake is copied
+// to dst/<flake directory name> and the input to dst/shared.
+func copySources(log *slog.Logger, args Args, dst string) (source manifest.Source, err error) {
+	codeDir, err := filepath.Abs(args.Code)
+	if err != nil {
+		return source, fmt.Errorf("failed to get absolute source path: %w", err)
+	}
+	dirs, pathInputs, err := getSourceDirs(codeDir)
+	if err != nil {
+		return source, err
+	}
+	source.PathInputs = pathInputs
+	root := commonDir(dirs)
+	if source.Dir, err = filepath.Rel(root, codeDir); err != nil {
+		return source, fmt.Errorf("failed to get flake directory: %w", err)
+	}
+	if source.Dir == "." {
+		source.Dir = ""
+	}
+	source.Dir = filepath.ToSlash(source.Dir)
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return source, fmt.Errorf("failed to get relative path of %q: %w", dir, err)
+		}
+		if dir != codeDir {
+			log.Info("Copying path input source code", slog.String("dir", dir), slog.String("target", rel))
+		}
+		if err = copySource(args.SourceFiles, dir, filepath.Join(dst, rel)); err != nil {
+			return source, err
+		}
+	}
+	return source, nil
+}
+
+// getSourceDirs returns the absolute directories that are copied to export the source code of the flake in codeDir:
+// codeDir, and the directories of its path inputs that are outside of it.
+func getSourceDirs(codeDir string) (dirs []string, pathInputs []manifest.PathInput, err error) {
+	inputs, err := getPathInputs(codeDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs = []string{codeDir}
+	for _, input := range inputs {
+		dir := filepath.Join(codeDir, filepath.FromSlash(input.Path))
+		if _, err := os.Stat(dir); err != nil {
+			return nil, nil, fmt.Errorf("path input %q not found at %q: %w", input.Name, dir, err)
+		}
+		pathInputs = append(pathInputs, manifest.PathInput{Name: input.Name, Path: input.Path})
+		dirs = append(dirs, dir)
+	}
+	return topLevelDirs(dirs), pathInputs, nil
+}
+
+// getPathInputs returns the relative path inputs in the flake.lock file of the flake in codeDir.
+func getPathInputs(codeDir string) (inputs []nixcmd.PathInput, err error) {
+	f, err := os.Open(filepath.Join(codeDir, "flake.lock"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open flake.lock: %w", err)
+	}
+	defer f.Close()
+	l, err := nixcmd.ReadFlakeLock(f)
+	if err != nil {
+		return nil, err
+	}
+	return l.PathInputs()
+}
+
+// topLevelDirs returns the dirs that are not within any of the other dirs.
+func topLevelDirs(dirs []string) (top []string) {
+	for _, dir := range dirs {
+		within := slices.ContainsFunc(dirs, func(other string) bool {
+			return other != dir && isWithin(other, dir)
+		})
+		if !within && !slices.Contains(top, dir) {
+			top = append(top, dir)
+		}
+	}
+	return top
+}
+
+// commonDir returns the deepest directory that contains all of the dirs.
+func commonDir(dirs []string) (common string) {
+	common = dirs[0]
+	for _, dir := range dirs[1:] {
+		for !isWithin(common, dir) {
+			common = filepath.Dir(common)
+		}
+	}
+	return common
+}
+
+// isWithin returns true if dir is, or is within, parent.
+func isWithin(parent, dir string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copySource copies the source code files in srcDir, selected by sourceFiles, to dst.
+func copySource(sourceFiles, srcDir, dst string) (err error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return fmt.Errorf("failed to create source output directory: %w", err)
+	}
+	fsys := os.DirFS(srcDir)
+	var filter sourceFilter
+	switch sourceFiles {
+	case SourceFilesGit:
+		// git ls-files -z --cached
+		files, err := gitcmd.LsFiles(io.Discard, os.Stderr, srcDir)
+		if err != nil {
+			return fmt.Errorf("failed to list git tracked files: %w", err)
+		}
+		filter = newTrackedFilter(files)
+	default:
+		if filter, err = newSourceIgnoreFilter(srcDir, fsys); err != nil {
+			return err
+		}
+	}
+	if err := os.CopyFS(dst, newFilteredFS(fsys, filter)); err != nil {
+		return fmt.Errorf("failed to copy source code: %w", err)
+	}
+	return nil
+}
+
+// sourceFilter decides whether a slash separated path within the source code is left out of the export.
+type sourceFilter interface {
+	Ignored(name string, isDir bool) (bool, error)
+}
+
+// ignoreFilter ignores paths with gitignore semantics. The .gitignore and .flakegapignore files of each directory are
+// read when the directory is first listed. Patterns in .flakegapignore files take precedence over .gitignore files, so
+// that they can re-include files with "!".
+type ignoreFilter struct {
+	fsys fs.FS
+	// prefix is the slash separated directory of fsys within its git repository, e.g. nix, or empty if fsys is the root.
+	// Patterns are matched against paths relative to the root, so that ignore files outside of fsys apply.
+	prefix  string
+	loaded  map[string]struct{}
+	ignores map[string]gitignore.Matcher
+}
+
+func newIgnoreFilter(fsys fs.FS) *ignoreFilter {
+	f := &ignoreFilter{
+		fsys:    fsys,
+		loaded:  make(map[string]struct{}),
+		ignores: make(map[string]gitignore.Matcher),
+	}
+	for _, pattern := range defaultIgnore {
+		p, _ := gitignore.ParsePattern(pattern, "")
+		f.ignores[".gitignore"] = append(f.ignores[".gitignore"], p)
+	}
+	return f
+}
+
+// newSourceIgnoreFilter returns an ignoreFilter for the source code in srcDir. If srcDir is within a git repository, the
+// patterns that git applies to it from outside of srcDir are used too: core.excludesFile, info/exclude, and the
+// .gitignore files of the parent directories up to the root of the repository.
+func newSourceIgnoreFilter(srcDir string, fsys fs.FS) (f *ignoreFilter, err error) {
+	f = newIgnoreFilter(fsys)
+	// git rev-parse --show-prefix
+	prefix, err := gitcmd.Prefix(io.Discard, io.Discard, srcDir)
+	if err != nil {
+		// The source code isn't in a git repository.
+		return f, nil
+	}
+	f.prefix = strings.Trim(prefix, "/")
+	// git config --path --get core.excludesFile
+	excludesFile, err := gitcmd.ExcludesFile(io.Discard, os.Stderr, srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get core.excludesFile: %w", err)
+	}
+	// git rev-parse --git-path info/exclude
+	infoExclude, err := gitcmd.GitPath(io.Discard, os.Stderr, srcDir, "info/exclude")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info/exclude path: %w", err)
+	}
+	for _, fileName := range []string{excludesFile, infoExclude} {
+		if err = f.loadFile(fileName, ""); err != nil {
+			return nil, err
+		}
+	}
+	// The .gitignore files of srcDir and its subdirectories are loaded from fsys as they're listed.
+	var parents []string
+	if f.prefix != "" {
+		parents = strings.Split(f.prefix, "/")
+	}
+	for i := range parents {
+		fileName := filepath.Join(srcDir, strings.Repeat("../", len(parents)-i), ".gitignore")
+		if err = f.loadFile(fileName, path.Join(parents[:i]...)); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// loadFile adds the patterns of the ignore file at fileName, which apply to the slash separated patternDir within the
+// repository, to the .gitignore patterns. Files that don't exist are skipped.
+func (f *ignoreFilter) loadFile(fileName, patternDir string) error {
+	if fileName == "" {
+		return nil
+	}
+	r, err := os.Open(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", fileName, err)
+	}
+	defer r.Close()
+	patterns, err := gitignore.Parse(r, patternDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", fileName, err)
+	}
+	f.ignores[".gitignore"] = append(f.ignores[".gitignore"], patterns...)
+	return nil
+}
+
+func (f *ignoreFilter) load(dir string) error {
+	if _, ok := f.loaded[dir]; ok {
+		return nil
+	}
+	f.loaded[dir] = struct{}{}
+	patternDir := path.Join(f.prefix, dir)
+	if patternDir == "." {
+		patternDir = ""
+	}
+	for _, name := range ignoreFileNames {
+		r, err := f.fsys.Open(path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open %q: %w", path.Join(dir, name), err)
+		}
+		patterns, err := gitignore.Parse(r, patternDir)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", path.Join(dir, name), err)
+		}
+		f.ignores[name] = append(f.ignores[name], patterns...)
+	}
+	return nil
+}
+
+func (f *ignoreFilter) Ignored(name string, isDir bool) (ignored bool, err error) {
+	if err = f.load(path.Dir(name)); err != nil {
+		return false, err
+	}
+	name = path.Join(f.prefix, name)
+	for _, fileName := range ignoreFileNames {
+		if fileIgnored, matched := f.ignores[fileName].Match(name, isDir); matched {
+			ignored = fileIgnored
+		}
+	}
+	return ignored, nil
+}
+
+// trackedFilter ignores paths that are not tracked by git, and are not the parent directories of tracked files.
+// Everything within a tracked directory, i.e. a submodule, is included.
+type trackedFilter struct {
+	files map[string]struct{}
+	dirs  map[string]struct{}
+}
+
+func newTrackedFilter(files []string) trackedFilter {
+	f := trackedFilter{
+		files: make(map[string]struct{}, len(files)),
+		dirs:  make(map[string]struct{}),
+	}
+	for _, file := range files {
+		f.files[file] = struct{}{}
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			f.dirs[dir] = struct{}{}
+		}
+	}
+	return f
+}
+
+func (f trackedFilter) Ignored(name string, isDir bool) (bool, error) {
+	if _, ok := f.dirs[name]; ok && isDir {
+		return false, nil
+	}
+	for p := name; p != "."; p = path.Dir(p) {
+		if _, ok := f.files[p]; ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type filteredFS struct {
+	fsys   fs.FS
+	filter sourceFilter
+}
+
+func newFilteredFS(fsys fs.FS, filter sourceFilter) filteredFS {
+	return filteredFS{fsys: fsys, filter: filter}
+}
+
+func (f filteredFS) Open(name string) (fs.File, error) {
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &filteredFile{File: file, name: name, filter: f.filter}, nil
+}
+
+func (f filteredFS) ReadLink(name string) (string, error) {
+	rl, ok := f.fsys.(fs.ReadLinkFS)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	return rl.ReadLink(name)
+}
+
+type filteredFile struct {
+	fs.File
+	name   string
+	filter sourceFilter
+}
+
+func (f *filteredFile) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	all, err := dir.ReadDir(n)
+	if err != nil {
+		return all, err
+	}
+	entries = make([]fs.DirEntry, 0, len(all))
+	for _, e := range all {
+		ignored, err := f.filter.Ignored(path.Join(f.name, e.Name()), e.IsDir())
+		if err != nil {
+			return nil, err
+		}
+		if !ignored {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
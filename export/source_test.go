@@ -0,0 +1,143 @@
+package export
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func walkFiles(t *testing.T, fsys fs.FS) (files []string) {
+	t.Helper()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk: %v", err)
+	}
+	return files
+}
+
+func TestIgnoreFilter(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":                  {Data: []byte("node_modules/\n*.env\n/build\n")},
+		".flakegapignore":             {Data: []byte("!example.env\nsecrets/\n")},
+		"flake.nix":                   {},
+		"example.env":                 {},
+		"prod.env":                    {},
+		"result/bin/app":              {},
+		"build/app":                   {},
+		"secrets/key":                 {},
+		"web/.gitignore":              {Data: []byte("/dist\n!keep.env\n")},
+		"web/build/app.js":            {},
+		"web/dist/app.js":             {},
+		"web/keep.env":                {},
+		"web/node_modules/react/a.js": {},
+	}
+	actual := walkFiles(t, newFilteredFS(fsys, newIgnoreFilter(fsys)))
+	expected := []string{
+		".flakegapignore",
+		".gitignore",
+		"example.env",
+		"flake.nix",
+		"web/.gitignore",
+		"web/build/app.js",
+		"web/keep.env",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func TestTrackedFilter(t *testing.T) {
+	fsys := fstest.MapFS{
+		"flake.nix":        {},
+		"untracked.txt":    {},
+		"cmd/app/main.go":  {},
+		"cmd/app/main.out": {},
+		"vendor/lib/a.go":  {},
+		"vendor/lib/b.go":  {},
+		"docs/untracked":   {},
+	}
+	tracked := []string{"flake.nix", "cmd/app/main.go", "vendor/lib"}
+	actual := walkFiles(t, newFilteredFS(fsys, newTrackedFilter(tracked)))
+	expected := []string{
+		"cmd/app/main.go",
+		"flake.nix",
+		"vendor/lib/a.go",
+		"vendor/lib/b.go",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func TestSourceDirs(t *testing.T) {
+	dirs := []string{"/repo/app", "/repo/shared", "/repo/app/sub", "/repo/libs/utils", "/repo/shared"}
+	top := topLevelDirs(dirs)
+	if diff := cmp.Diff([]string{"/repo/app", "/repo/shared", "/repo/libs/utils"}, top); diff != "" {
+		t.Errorf("unexpected top level dirs (-want +got):\n%s", diff)
+	}
+	if common := commonDir(top); common != "/repo" {
+		t.Errorf("expected common dir /repo, got %q", common)
+	}
+	if common := commonDir([]string{"/repo/app"}); common != "/repo/app" {
+		t.Errorf("expected common dir /repo/app, got %q", common)
+	}
+	if isWithin("/repo/app", "/repo/application") {
+		t.Error("expected /repo/application not to be within /repo/app")
+	}
+}
+
+func TestCopySourceGitIgnoreFilesOutsideFlake(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found on path")
+	}
+	repo := t.TempDir()
+	runGit(t, repo, "init", "--quiet")
+	excludesFile := filepath.Join(t.TempDir(), "ignore")
+	runGit(t, repo, "config", "core.excludesFile", excludesFile)
+	files := map[string]string{
+		".gitignore":         "*.log\n/nix/build\n",
+		".git/info/exclude":  "local/\n",
+		"nix/flake.nix":      "{}",
+		"nix/app.log":        "",
+		"nix/build/app":      "",
+		"nix/local/config":   "",
+		"nix/notes.tmp":      "",
+		"nix/src/.gitignore": "!debug.log\n",
+		"nix/src/debug.log":  "",
+		"nix/src/main.go":    "",
+	}
+	for name, content := range files {
+		fileName := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(excludesFile, []byte("*.tmp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := copySource(SourceFilesGitignore, filepath.Join(repo, "nix"), dst); err != nil {
+		t.Fatalf("failed to copy source: %v", err)
+	}
+	expected := []string{"flake.nix", "src/.gitignore", "src/debug.log", "src/main.go"}
+	if diff := cmp.Diff(expected, walkFiles(t, os.DirFS(dst))); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// workspaceFlake is a flake to export.
+type workspaceFlake struct {
+	// Name of the flake within the workspace, used as its directory within sources/. Empty if a single flake is
+	// exported, in which case its source code is exported to source/.
+	Name string
+	// Code is the directory of the flake.
+	Code string
+}
+
+// getWorkspaceFlakes returns the flakes to export. If the export isn't a workspace export, the single flake in
+// args.Code is returned, without a name.
+func getWorkspaceFlakes(args Args) (flakes []workspaceFlake, err error) {
+	if args.Discover != "" {
+		return discoverFlakes(args.Discover)
+	}
+	if len(args.SourcePaths) == 0 {
+		return []workspaceFlake{{Code: args.Code}}, nil
+	}
+	for _, dir := range args.SourcePaths {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute source path: %w", err)
+		}
+		flakes = append(flakes, workspaceFlake{Name: filepath.Base(abs), Code: dir})
+	}
+	return flakes, checkFlakeNames(flakes)
+}
+
+// discoverFlakes returns the flakes within root, named by their slash separated path within root. A flake at the root
+// is named after the root directory.
+func discoverFlakes(root string) (flakes []workspaceFlake, err error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path of %q: %w", root, err)
+	}
+	dirs, err := findFlakes(os.DirFS(abs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover flakes in %q: %w", root, err)
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no flake.nix files found in %q", root)
+	}
+	for _, dir := range dirs {
+		name := dir
+		if dir == "." {
+			name = filepath.Base(abs)
+		}
+		flakes = append(flakes, workspaceFlake{Name: name, Code: filepath.Join(abs, filepath.FromSlash(dir))})
+	}
+	return flakes, checkFlakeNames(flakes)
+}
+
+// findFlakes returns the slash separated directories within fsys that contain a flake.nix file. Directories that are
+// ignored by .gitignore and .flakegapignore files, and .git directories, are not searched.
+func findFlakes(fsys fs.FS) (dirs []string, err error) {
+	err = fs.WalkDir(newFilteredFS(fsys, newIgnoreFilter(fsys)), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if !d.IsDir() && d.Name() == "flake.nix" {
+			dirs = append(dirs, path.Dir(name))
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// checkFlakeNames returns an error if more than one flake has the same name, since they would be exported to the same
+// directory, or if a flake is within the directory of another flake, since its source code would be exported twice, as
+// part of the other flake's source code, and its directory in sources/ could clash with the other flake's.
+func checkFlakeNames(flakes []workspaceFlake) error {
+	codeDirs := make(map[string]string, len(flakes))
+	for _, f := range flakes {
+		if other, ok := codeDirs[f.Name]; ok {
+			return fmt.Errorf("flakes %q and %q have the same name %q, use -discover to name flakes by their path", other, f.Code, f.Name)
+		}
+		codeDirs[f.Name] = f.Code
+	}
+	absDirs := make([]string, len(flakes))
+	for i, f := range flakes {
+		abs, err := filepath.Abs(f.Code)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path of %q: %w", f.Code, err)
+		}
+		absDirs[i] = abs
+	}
+	for i, f := range flakes {
+		for j, parent := range flakes {
+			if i == j {
+				continue
+			}
+			if isWithin(filepath.FromSlash(parent.Name), filepath.FromSlash(f.Name)) || isWithin(absDirs[j], absDirs[i]) {
+				return fmt.Errorf("flake %q is within flake %q, nested flakes can't be exported to the same bundle, export them separately", f.Code, parent.Code)
+			}
+		}
+	}
+	return nil
+}
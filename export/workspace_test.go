@@ -0,0 +1,104 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFindFlakes(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":                          {Data: []byte("node_modules/\n")},
+		"flake.nix":                           {},
+		"services/flake.nix":                  {},
+		"services/api/flake.nix":              {},
+		"services/api/main.go":                {},
+		"services/web/flake.nix":              {},
+		"services/web/node_modules/flake.nix": {},
+		"libs/shared/default.nix":             {},
+		".git/flake.nix":                      {},
+		"result/flake.nix":                    {},
+	}
+	dirs, err := findFlakes(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Nested flakes are found, and rejected by checkFlakeNames.
+	expected := []string{".", "services/api", "services", "services/web"}
+	if diff := cmp.Diff(expected, dirs); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckFlakeNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		flakes    []workspaceFlake
+		expectErr bool
+	}{
+		{
+			name: "unique names are valid",
+			flakes: []workspaceFlake{
+				{Name: "api", Code: "services/api"},
+				{Name: "web", Code: "services/web"},
+			},
+		},
+		{
+			name: "similar prefixes are not nested",
+			flakes: []workspaceFlake{
+				{Name: "api", Code: "services/api"},
+				{Name: "api-v2", Code: "services/api-v2"},
+			},
+		},
+		{
+			name: "nested names are an error",
+			flakes: []workspaceFlake{
+				{Name: "services", Code: "/workspace/services"},
+				{Name: "services/api", Code: "/other/services/api"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "flakes within the directory of another flake are an error",
+			flakes: []workspaceFlake{
+				{Name: "workspace", Code: "workspace"},
+				{Name: "api", Code: "workspace/services/api"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "duplicate names are an error",
+			flakes: []workspaceFlake{
+				{Name: "app", Code: "api/app"},
+				{Name: "app", Code: "web/app"},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFlakeNames(tt.flakes)
+			if tt.expectErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestDiscoverNestedFlakes(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"services", "services/api"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "flake.nix"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := discoverFlakes(root); err == nil {
+		t.Error("expected nested flakes to be an error")
+	}
+}
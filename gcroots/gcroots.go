@@ -0,0 +1,197 @@
+package gcroots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// DefaultDir is the directory that GC roots of imported exports are created in. Nix treats symlinks to store paths
+// within /nix/var/nix/gcroots as garbage collector roots.
+const DefaultDir = "/nix/var/nix/gcroots/flakegap"
+
+// Root is a GC root of an imported export.
+type Root struct {
+	// Name of the root, e.g. packages.x86_64-linux.default.
+	Name string
+	// StorePath that the root keeps alive.
+	StorePath string
+}
+
+// Bundle is the set of GC roots of an imported export.
+type Bundle struct {
+	// ID of the export, from its manifest.
+	ID string
+	// Roots of the outputs of the export.
+	Roots []Root
+	// Paths is the number of store paths that are rooted in the paths directory of the bundle, to keep the rest of the
+	// imported store paths alive, such as derivations and build inputs.
+	Paths int
+}
+
+// pathsDir is the directory within the roots of a bundle that contains a root for each store path that has to be kept
+// alive in addition to the outputs, named after the store path.
+const pathsDir = "paths"
+
+// Add creates a GC root for the store path within dir/<bundle ID>/, replacing any existing root with the same name.
+// Names are made safe to use as file names, so "/" is replaced with "-".
+func Add(dir, bundleID, name, storePath string) (err error) {
+	if err = checkBundleID(bundleID); err != nil {
+		return err
+	}
+	return addRoot(filepath.Join(dir, bundleID), strings.ReplaceAll(name, "/", "-"), storePath)
+}
+
+// AddPath creates a GC root for the store path within dir/<bundle ID>/paths/, named after the store path, e.g.
+// <hash>-bash-5.2.drv.
+func AddPath(dir, bundleID, storePath string) (err error) {
+	if err = checkBundleID(bundleID); err != nil {
+		return err
+	}
+	return addRoot(filepath.Join(dir, bundleID, pathsDir), filepath.Base(storePath), storePath)
+}
+
+func addRoot(rootsDir, name, storePath string) (err error) {
+	if err = os.MkdirAll(rootsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create GC roots directory %q: %w", rootsDir, err)
+	}
+	fileName := filepath.Join(rootsDir, name)
+	if err = os.Remove(fileName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove existing GC root %q: %w", fileName, err)
+	}
+	if err = os.Symlink(storePath, fileName); err != nil {
+		return fmt.Errorf("failed to create GC root %q: %w", fileName, err)
+	}
+	return nil
+}
+
+// List returns the GC roots within dir, grouped by bundle, sorted by bundle ID and root name. If dir doesn't exist, no
+// bundles are returned.
+func List(dir string) (bundles []Bundle, err error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GC roots directory %q: %w", dir, err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b := Bundle{ID: e.Name()}
+		rootEntries, err := os.ReadDir(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GC roots of bundle %q: %w", e.Name(), err)
+		}
+		for _, re := range rootEntries {
+			if re.IsDir() && re.Name() == pathsDir {
+				pathEntries, err := os.ReadDir(filepath.Join(dir, e.Name(), pathsDir))
+				if err != nil {
+					return nil, fmt.Errorf("failed to read GC roots of bundle %q: %w", e.Name(), err)
+				}
+				b.Paths = len(pathEntries)
+				continue
+			}
+			if re.Type()&fs.ModeSymlink == 0 {
+				continue
+			}
+			target, err := os.Readlink(filepath.Join(dir, e.Name(), re.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read GC root %q: %w", re.Name(), err)
+			}
+			b.Roots = append(b.Roots, Root{Name: re.Name(), StorePath: target})
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles, nil
+}
+
+// Remove the GC roots of the bundle from dir, so that its store paths can be garbage collected.
+func Remove(dir, bundleID string) (err error) {
+	if err = checkBundleID(bundleID); err != nil {
+		return err
+	}
+	bundleDir := filepath.Join(dir, bundleID)
+	if _, err = os.Stat(bundleDir); err != nil {
+		return fmt.Errorf("no GC roots found for bundle %q: %w", bundleID, err)
+	}
+	if err = os.RemoveAll(bundleDir); err != nil {
+		return fmt.Errorf("failed to remove GC roots of bundle %q: %w", bundleID, err)
+	}
+	return nil
+}
+
+// checkBundleID returns an error if the ID isn't a single path element, so that it can't refer to a directory outside
+// of the GC roots directory.
+func checkBundleID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid bundle ID %q", id)
+	}
+	return nil
+}
+
+type Args struct {
+	// Dir is the directory containing the GC roots of imported exports, defaults to DefaultDir.
+	Dir string
+	// Remove are the IDs of bundles to remove the GC roots of.
+	Remove []string
+	// Help shows usage and quits.
+	Help bool
+}
+
+func (a Args) Validate() error {
+	var errs []error
+	if a.Dir == "" {
+		errs = append(errs, fmt.Errorf("dir is required"))
+	}
+	for _, id := range a.Remove {
+		if err := checkBundleID(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run lists the GC roots of imported exports, or removes the roots of the bundles in args.Remove.
+func Run(ctx context.Context, log *slog.Logger, args Args) (err error) {
+	if len(args.Remove) == 0 {
+		return list(log, args.Dir, os.Stdout)
+	}
+	for _, id := range args.Remove {
+		if err = Remove(args.Dir, id); err != nil {
+			return err
+		}
+		log.Info("Removed GC roots, run nix-collect-garbage to delete the store paths", slog.String("bundle", id))
+	}
+	return nil
+}
+
+func list(log *slog.Logger, dir string, w io.Writer) (err error) {
+	bundles, err := List(dir)
+	if err != nil {
+		return err
+	}
+	if len(bundles) == 0 {
+		log.Info("No GC roots found", slog.String("dir", dir))
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUNDLE\tROOT\tSTORE PATH")
+	for _, b := range bundles {
+		for _, r := range b.Roots {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", b.ID, r.Name, r.StorePath)
+		}
+		if b.Paths > 0 {
+			fmt.Fprintf(tw, "%s\t%s/\t%d store paths\n", b.ID, pathsDir, b.Paths)
+		}
+	}
+	return tw.Flush()
+}
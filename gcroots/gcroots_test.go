@@ -0,0 +1,81 @@
+package gcroots
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRoots(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "gcroots")
+
+	bundles, err := List(dir)
+	if err != nil {
+		t.Fatalf("failed to list missing directory: %v", err)
+	}
+	if len(bundles) != 0 {
+		t.Errorf("expected no bundles, got %v", bundles)
+	}
+
+	roots := []struct {
+		bundleID, name, storePath string
+	}{
+		{bundleID: "b2", name: "packages.x86_64-linux.default", storePath: "/nix/store/a-app"},
+		{bundleID: "b1", name: "services/api#devShells.x86_64-linux.default-env", storePath: "/nix/store/b-env"},
+		{bundleID: "b1", name: "devShells.x86_64-linux.default", storePath: "/nix/store/c-shell"},
+		// Adding a root with the same name replaces it.
+		{bundleID: "b1", name: "devShells.x86_64-linux.default", storePath: "/nix/store/d-shell"},
+	}
+	for _, r := range roots {
+		if err := Add(dir, r.bundleID, r.name, r.storePath); err != nil {
+			t.Fatalf("failed to add root: %v", err)
+		}
+	}
+	for _, storePath := range []string{"/nix/store/e-shell.drv", "/nix/store/f-bash"} {
+		if err := AddPath(dir, "b1", storePath); err != nil {
+			t.Fatalf("failed to add path root: %v", err)
+		}
+	}
+
+	bundles, err = List(dir)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	expected := []Bundle{
+		{
+			ID: "b1",
+			Roots: []Root{
+				{Name: "devShells.x86_64-linux.default", StorePath: "/nix/store/d-shell"},
+				{Name: "services-api#devShells.x86_64-linux.default-env", StorePath: "/nix/store/b-env"},
+			},
+			Paths: 2,
+		},
+		{
+			ID: "b2",
+			Roots: []Root{
+				{Name: "packages.x86_64-linux.default", StorePath: "/nix/store/a-app"},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, bundles); diff != "" {
+		t.Error(diff)
+	}
+
+	if err = Remove(dir, "b1"); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if err = Remove(dir, "b1"); err == nil {
+		t.Error("expected removing a missing bundle to be an error")
+	}
+	if err = Remove(dir, ".."); err == nil {
+		t.Error("expected an invalid bundle ID to be an error")
+	}
+	bundles, err = List(dir)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if diff := cmp.Diff(expected[1:], bundles); diff != "" {
+		t.Error(diff)
+	}
+}
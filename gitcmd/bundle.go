@@ -0,0 +1,14 @@
+package gitcmd
+
+import (
+	"io"
+)
+
+// Bundle writes every ref of the git repository that contains codeDir, and their history, to the bundle file.
+// The fileName is relative to codeDir, unless it's absolute.
+//
+//	git bundle create <fileName> --all
+func Bundle(stdout, stderr io.Writer, codeDir, fileName string) (err error) {
+	_, err = output(stdout, stderr, codeDir, "bundle", "create", fileName, "--all")
+	return err
+}
@@ -0,0 +1,30 @@
+package gitcmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/a-h/flakegap/nixcmd"
+)
+
+// output runs git with the args in codeDir, and returns its stdout.
+func output(stdout, stderr io.Writer, codeDir string, args ...string) (op []byte, err error) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return op, fmt.Errorf("failed to find git on path: %w", err)
+	}
+
+	stdoutBuffer := new(bytes.Buffer)
+	cmd := exec.Command(gitPath, args...)
+	cmd.Dir = codeDir
+
+	w, closer := nixcmd.ErrorBuffer(stdout, stderr)
+	cmd.Stdout = stdoutBuffer
+	cmd.Stderr = w
+	if err = closer(cmd.Run()); err != nil {
+		return op, fmt.Errorf("failed to run git %s: %w", args[0], err)
+	}
+	return stdoutBuffer.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package gitcmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitPath returns the path of a file within the git directory of the repository that contains codeDir, e.g.
+// info/exclude. Worktrees and submodules have their own git directories.
+//
+//	git rev-parse --git-path <name>
+func GitPath(stdout, stderr io.Writer, codeDir, name string) (fileName string, err error) {
+	op, err := output(stdout, stderr, codeDir, "rev-parse", "--git-path", name)
+	if err != nil {
+		return fileName, err
+	}
+	fileName = strings.TrimSpace(string(op))
+	if !filepath.IsAbs(fileName) {
+		fileName = filepath.Join(codeDir, fileName)
+	}
+	return fileName, nil
+}
+
+// ExcludesFile returns the global ignore file that git uses for the repository that contains codeDir, set by
+// core.excludesFile, or $XDG_CONFIG_HOME/git/ignore if it's not set.
+//
+//	git config --path --get core.excludesFile
+func ExcludesFile(stdout, stderr io.Writer, codeDir string) (fileName string, err error) {
+	op, err := output(stdout, stderr, codeDir, "config", "--path", "--get", "core.excludesFile")
+	if err == nil {
+		return strings.TrimSpace(string(op)), nil
+	}
+	// git config exits with 1 if the key isn't set.
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		return fileName, err
+	}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "git", "ignore"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+	return filepath.Join(home, ".config", "git", "ignore"), nil
+}
@@ -0,0 +1,41 @@
+package gitcmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// lfsPointerPrefix is the start of a Git LFS pointer file, which is checked out in place of the content of the file
+// when the LFS object has not been pulled.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// LFSFiles returns the files in the index of the git repository that contains codeDir that are stored in Git LFS,
+// relative to codeDir. It doesn't require git-lfs to be installed.
+//
+//	git ls-files -z ':(attr:filter=lfs)'
+func LFSFiles(stdout, stderr io.Writer, codeDir string) (files []string, err error) {
+	op, err := output(stdout, stderr, codeDir, "ls-files", "-z", ":(attr:filter=lfs)")
+	if err != nil {
+		return files, err
+	}
+	for f := range strings.SplitSeq(string(op), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// IsLFSPointer returns true if r contains a Git LFS pointer, rather than the content of the file.
+func IsLFSPointer(r io.Reader) (bool, error) {
+	buf := make([]byte, len(lfsPointerPrefix))
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(buf[:n], []byte(lfsPointerPrefix)), nil
+}
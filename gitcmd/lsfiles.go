@@ -0,0 +1,23 @@
+package gitcmd
+
+import (
+	"io"
+	"strings"
+)
+
+// LsFiles returns the files in the index of the git repository that contains codeDir, relative to codeDir. These are
+// the files that Nix copies to the store when it evaluates a flake in a git repository.
+//
+//	git ls-files -z --cached
+func LsFiles(stdout, stderr io.Writer, codeDir string) (files []string, err error) {
+	op, err := output(stdout, stderr, codeDir, "ls-files", "-z", "--cached")
+	if err != nil {
+		return files, err
+	}
+	for f := range strings.SplitSeq(string(op), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,17 @@
+package gitcmd
+
+import (
+	"io"
+	"strings"
+)
+
+// Revision returns the commit hash of HEAD in the git repository that contains codeDir.
+//
+//	git rev-parse HEAD
+func Revision(stdout, stderr io.Writer, codeDir string) (rev string, err error) {
+	op, err := output(stdout, stderr, codeDir, "rev-parse", "HEAD")
+	if err != nil {
+		return rev, err
+	}
+	return strings.TrimSpace(string(op)), nil
+}
@@ -0,0 +1,62 @@
+package gitcmd
+
+import (
+	"io"
+	"strings"
+)
+
+// Branch returns the name of the branch that is checked out in the git repository that contains codeDir, or an empty
+// string if HEAD is detached.
+//
+//	git rev-parse --abbrev-ref HEAD
+func Branch(stdout, stderr io.Writer, codeDir string) (branch string, err error) {
+	op, err := output(stdout, stderr, codeDir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return branch, err
+	}
+	if branch = strings.TrimSpace(string(op)); branch == "HEAD" {
+		return "", nil
+	}
+	return branch, nil
+}
+
+// IsDirty returns true if tracked files in the git repository that contains codeDir have uncommitted changes. If
+// untracked is set, untracked files that are not ignored also make the repository dirty, which is required when they're
+// exported along with the tracked files.
+//
+//	git status --porcelain --untracked-files=no
+//	git status --porcelain --untracked-files=normal
+func IsDirty(stdout, stderr io.Writer, codeDir string, untracked bool) (dirty bool, err error) {
+	untrackedFiles := "--untracked-files=no"
+	if untracked {
+		untrackedFiles = "--untracked-files=normal"
+	}
+	op, err := output(stdout, stderr, codeDir, "status", "--porcelain", untrackedFiles)
+	if err != nil {
+		return dirty, err
+	}
+	return strings.TrimSpace(string(op)) != "", nil
+}
+
+// Prefix returns the slash separated path of codeDir relative to the root of its git repository, e.g. nix/, or an
+// empty string if codeDir is the root.
+//
+//	git rev-parse --show-prefix
+func Prefix(stdout, stderr io.Writer, codeDir string) (prefix string, err error) {
+	op, err := output(stdout, stderr, codeDir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return prefix, err
+	}
+	return strings.TrimSpace(string(op)), nil
+}
+
+// TopLevel returns the root directory of the git repository that contains codeDir.
+//
+//	git rev-parse --show-toplevel
+func TopLevel(stdout, stderr io.Writer, codeDir string) (dir string, err error) {
+	op, err := output(stdout, stderr, codeDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return dir, err
+	}
+	return strings.TrimSpace(string(op)), nil
+}
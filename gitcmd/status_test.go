@@ -0,0 +1,117 @@
+package gitcmd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo creates a git repository in a temporary directory, with a single commit of the files.
+func newTestRepo(t *testing.T, files map[string]string) (dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found on path")
+	}
+	dir = t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, name), content)
+	}
+	runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "--quiet", "-m", "initial")
+	return dir
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = dir
+	if op, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, op)
+	}
+}
+
+func writeTestFile(t *testing.T, fileName, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsDirty(t *testing.T) {
+	tests := []struct {
+		name              string
+		files             map[string]string
+		expected          bool
+		expectedUntracked bool
+	}{
+		{
+			name: "clean",
+		},
+		{
+			name:              "modified tracked file",
+			files:             map[string]string{"flake.nix": "{ }"},
+			expected:          true,
+			expectedUntracked: true,
+		},
+		{
+			name:              "untracked file",
+			files:             map[string]string{"secret.txt": "secret"},
+			expected:          false,
+			expectedUntracked: true,
+		},
+		{
+			name:              "ignored file",
+			files:             map[string]string{"result/bin/app": ""},
+			expected:          false,
+			expectedUntracked: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newTestRepo(t, map[string]string{"flake.nix": "{}", ".gitignore": "result/\n"})
+			for name, content := range test.files {
+				writeTestFile(t, filepath.Join(dir, name), content)
+			}
+			dirty, err := IsDirty(io.Discard, io.Discard, dir, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dirty != test.expected {
+				t.Errorf("expected dirty %v, got %v", test.expected, dirty)
+			}
+			dirty, err = IsDirty(io.Discard, io.Discard, dir, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dirty != test.expectedUntracked {
+				t.Errorf("expected dirty %v including untracked files, got %v", test.expectedUntracked, dirty)
+			}
+		})
+	}
+}
+
+func TestBranch(t *testing.T) {
+	dir := newTestRepo(t, map[string]string{"flake.nix": "{}"})
+	branch, err := Branch(io.Discard, io.Discard, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if branch != "main" {
+		t.Errorf("expected branch main, got %q", branch)
+	}
+
+	runGit(t, dir, "checkout", "--quiet", "--detach")
+	branch, err = Branch(io.Discard, io.Discard, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if branch != "" {
+		t.Errorf("expected no branch when HEAD is detached, got %q", branch)
+	}
+}
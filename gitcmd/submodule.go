@@ -0,0 +1,63 @@
+package gitcmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Submodule is a git submodule, as reported by `git submodule status`.
+type Submodule struct {
+	// Path of the submodule, relative to the repository root.
+	Path string
+	// Commit of the submodule that is checked out, or that is recorded in the index if it's not initialised.
+	Commit string
+	// Initialised is false if the submodule has not been checked out, e.g. with `git submodule update --init`.
+	Initialised bool
+	// Modified is true if the checked out commit doesn't match the commit recorded in the index.
+	Modified bool
+	// Conflict is true if the submodule has merge conflicts.
+	Conflict bool
+}
+
+// Submodules returns the submodules of the git repository that contains codeDir, including nested submodules. git
+// reports their paths relative to codeDir, so codeDir should be the root of the repository.
+//
+//	git submodule status --recursive
+func Submodules(stdout, stderr io.Writer, codeDir string) (submodules []Submodule, err error) {
+	op, err := output(stdout, stderr, codeDir, "submodule", "status", "--recursive")
+	if err != nil {
+		return submodules, err
+	}
+	return parseSubmoduleStatus(string(op))
+}
+
+// parseSubmoduleStatus parses the output of `git submodule status`, e.g.
+//
+//	-a1b2c3d4 vendor/lib
+//	 e5f6a7b8 vendor/other (v1.0.0)
+func parseSubmoduleStatus(op string) (submodules []Submodule, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(op))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line) < 2 {
+			return nil, fmt.Errorf("invalid submodule status line %q", line)
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid submodule status line %q", line)
+		}
+		submodules = append(submodules, Submodule{
+			Path:        fields[1],
+			Commit:      fields[0],
+			Initialised: line[0] != '-',
+			Modified:    line[0] == '+',
+			Conflict:    line[0] == 'U',
+		})
+	}
+	return submodules, scanner.Err()
+}
@@ -0,0 +1,98 @@
+package gitcmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSubmoduleStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		op        string
+		expected  []Submodule
+		expectErr bool
+	}{
+		{
+			name: "no submodules",
+			op:   "",
+		},
+		{
+			name: "submodule states",
+			op: `-a1b2c3d4 vendor/missing
+ e5f6a7b8 vendor/ok (v1.0.0)
++c9d0e1f2 vendor/modified (heads/main)
+U0000000000 vendor/conflict
+ a1b2c3d4 vendor/ok/nested (a1b2c3d)
+`,
+			expected: []Submodule{
+				{Path: "vendor/missing", Commit: "a1b2c3d4"},
+				{Path: "vendor/ok", Commit: "e5f6a7b8", Initialised: true},
+				{Path: "vendor/modified", Commit: "c9d0e1f2", Initialised: true, Modified: true},
+				{Path: "vendor/conflict", Commit: "0000000000", Initialised: true, Conflict: true},
+				{Path: "vendor/ok/nested", Commit: "a1b2c3d4", Initialised: true},
+			},
+		},
+		{
+			name:      "invalid line",
+			op:        "-a1b2c3d4\n",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := parseSubmoduleStatus(test.op)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Errorf("unexpected submodules (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsLFSPointer(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{
+			name: "pointer",
+			content: `version https://git-lfs.github.com/spec/v1
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345
+`,
+			expected: true,
+		},
+		{
+			name:     "content",
+			content:  "\x89PNG\r\n\x1a\n not a pointer, but long enough to compare",
+			expected: false,
+		},
+		{
+			name:     "short content",
+			content:  "hello",
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := IsLFSPointer(strings.NewReader(test.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
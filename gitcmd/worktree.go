@@ -0,0 +1,30 @@
+package gitcmd
+
+import (
+	"io"
+)
+
+// WorktreeAdd checks out rev, which can be any commit-ish, e.g. a tag or commit hash, to a new worktree at dir, with
+// a detached HEAD. The dir must not exist, or be empty.
+//
+//	git worktree add --detach <dir> <rev>
+func WorktreeAdd(stdout, stderr io.Writer, codeDir, dir, rev string) (err error) {
+	_, err = output(stdout, stderr, codeDir, "worktree", "add", "--detach", dir, rev)
+	return err
+}
+
+// WorktreeRemove removes the worktree at dir, even if it has changes.
+//
+//	git worktree remove --force <dir>
+func WorktreeRemove(stdout, stderr io.Writer, codeDir, dir string) (err error) {
+	_, err = output(stdout, stderr, codeDir, "worktree", "remove", "--force", dir)
+	return err
+}
+
+// SubmoduleUpdate initialises and checks out the submodules of the git repository that contains codeDir.
+//
+//	git submodule update --init --recursive
+func SubmoduleUpdate(stdout, stderr io.Writer, codeDir string) (err error) {
+	_, err = output(stdout, stderr, codeDir, "submodule", "update", "--init", "--recursive")
+	return err
+}
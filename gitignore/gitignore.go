@@ -0,0 +1,126 @@
+// Package gitignore matches paths against patterns in the format of .gitignore files.
+package gitignore
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// Pattern is a single line of a .gitignore file.
+type Pattern struct {
+	// dir is the slash separated directory that contains the ignore file, relative to the root, or empty for the root.
+	dir string
+	// segments of the pattern, split on "/".
+	segments []string
+	// negate is set if the pattern starts with "!", which re-includes paths excluded by previous patterns.
+	negate bool
+	// dirOnly is set if the pattern ends with "/", which only matches directories.
+	dirOnly bool
+}
+
+// ParsePattern parses a line of an ignore file within dir, which is slash separated and relative to the root. It
+// returns false if the line is blank or a comment.
+func ParsePattern(line, dir string) (p Pattern, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	line = trimTrailingSpaces(line)
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+	// Patterns that contain a slash are relative to the directory of the ignore file, others match at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	p.segments = strings.Split(strings.ReplaceAll(line, "[!", "[^"), "/")
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	p.dir = strings.Trim(dir, "/")
+	return p, true
+}
+
+// trimTrailingSpaces removes trailing spaces, unless they're escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Parse reads the patterns of an ignore file within dir, which is slash separated and relative to the root.
+func Parse(r io.Reader, dir string) (patterns []Pattern, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if p, ok := ParsePattern(scanner.Text(), dir); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// Match returns true if the pattern matches the slash separated path, relative to the root.
+func (p Pattern) Match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.dir != "" {
+		var ok bool
+		if name, ok = strings.CutPrefix(name, p.dir+"/"); !ok {
+			return false
+		}
+	}
+	return matchSegments(p.segments, strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		// A trailing "**" matches everything inside the directory, but not the directory itself.
+		if len(pattern) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
+
+// Matcher is an ordered list of patterns, where later patterns take precedence over earlier ones.
+type Matcher []Pattern
+
+// Match returns whether the slash separated path, relative to the root, is ignored, and whether any pattern matched it.
+// As in git, a path within an ignored directory can't be re-included, so callers should skip the contents of ignored
+// directories rather than match them.
+func (m Matcher) Match(name string, isDir bool) (ignored, matched bool) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].Match(name, isDir) {
+			return !m[i].negate, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,199 @@
+package gitignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name            string
+		ignoreFile      string
+		dir             string
+		path            string
+		isDir           bool
+		expectedIgnored bool
+		expectedMatched bool
+	}{
+		{
+			name:            "name matches at the root",
+			ignoreFile:      "node_modules",
+			path:            "node_modules",
+			isDir:           true,
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "name matches at any depth",
+			ignoreFile:      "node_modules",
+			path:            "web/app/node_modules",
+			isDir:           true,
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "name does not match a prefix",
+			ignoreFile:      "node_modules",
+			path:            "node_modules_backup",
+			isDir:           true,
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "comments and blank lines are ignored",
+			ignoreFile:      "# result\n\n",
+			path:            "result",
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "escaped hash",
+			ignoreFile:      `\#notes`,
+			path:            "#notes",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "wildcard",
+			ignoreFile:      "*.log",
+			path:            "logs/server.log",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "wildcard does not match slashes",
+			ignoreFile:      "logs/*.log",
+			path:            "logs/old/server.log",
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "leading slash anchors to the ignore file directory",
+			ignoreFile:      "/build",
+			path:            "cmd/build",
+			isDir:           true,
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "middle slash anchors to the ignore file directory",
+			ignoreFile:      "docs/build",
+			path:            "docs/build",
+			isDir:           true,
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "trailing slash only matches directories",
+			ignoreFile:      "build/",
+			path:            "build",
+			isDir:           false,
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "trailing slash matches directories",
+			ignoreFile:      "build/",
+			path:            "cmd/build",
+			isDir:           true,
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "leading double star",
+			ignoreFile:      "**/secrets/*.key",
+			path:            "a/b/secrets/prod.key",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "middle double star matches zero directories",
+			ignoreFile:      "a/**/b",
+			path:            "a/b",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "middle double star matches several directories",
+			ignoreFile:      "a/**/b",
+			path:            "a/x/y/b",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "trailing double star matches contents",
+			ignoreFile:      "cache/**",
+			path:            "cache/a/b",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "trailing double star does not match the directory",
+			ignoreFile:      "cache/**",
+			path:            "cache",
+			isDir:           true,
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "negation re-includes",
+			ignoreFile:      "*.env\n!example.env",
+			path:            "config/example.env",
+			expectedIgnored: false,
+			expectedMatched: true,
+		},
+		{
+			name:            "last pattern wins",
+			ignoreFile:      "!example.env\n*.env",
+			path:            "example.env",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "character class negation",
+			ignoreFile:      "file[!0-9]",
+			path:            "filea",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "patterns in a subdirectory only apply within it",
+			ignoreFile:      "*.tmp",
+			dir:             "web",
+			path:            "api/a.tmp",
+			expectedIgnored: false,
+			expectedMatched: false,
+		},
+		{
+			name:            "anchored patterns in a subdirectory are relative to it",
+			ignoreFile:      "/dist",
+			dir:             "web",
+			path:            "web/dist",
+			isDir:           true,
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+		{
+			name:            "trailing spaces are trimmed",
+			ignoreFile:      "result  ",
+			path:            "result",
+			expectedIgnored: true,
+			expectedMatched: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patterns, err := Parse(strings.NewReader(test.ignoreFile), test.dir)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			ignored, matched := Matcher(patterns).Match(test.path, test.isDir)
+			if ignored != test.expectedIgnored {
+				t.Errorf("expected ignored %v, got %v", test.expectedIgnored, ignored)
+			}
+			if matched != test.expectedMatched {
+				t.Errorf("expected matched %v, got %v", test.expectedMatched, matched)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package importcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+	"github.com/dustin/go-humanize"
+	"github.com/nix-community/go-nix/pkg/narinfo"
+)
+
+// Statuses of outputs in an import dry run.
+const (
+	// outputPresent is an output whose store paths are already valid in the local store.
+	outputPresent = "present"
+	// outputNew is an output whose store paths would become valid by importing the export.
+	outputNew = "new"
+	// outputMissing is an output whose store paths are neither in the local store nor the export, e.g. the outputs of a
+	// sources export, which have to be built.
+	outputMissing = "missing"
+)
+
+// importSummary is what importing store paths would change in the local store.
+type importSummary struct {
+	NewPaths   int
+	NewBytes   uint64
+	ValidPaths int
+	ValidBytes uint64
+	Outputs    []outputStatus
+}
+
+type outputStatus struct {
+	Output manifest.Output
+	Status string
+}
+
+// summarise the import of the paths, given the NAR sizes of the paths in the export, and the paths that are not
+// valid in the local store.
+func summarise(narSizes map[string]uint64, paths []string, invalidPaths []string, outputs []manifest.Output) (s importSummary) {
+	invalid := make(map[string]struct{}, len(invalidPaths))
+	for _, p := range invalidPaths {
+		invalid[p] = struct{}{}
+	}
+	for _, p := range paths {
+		if _, ok := invalid[p]; ok {
+			s.NewPaths++
+			s.NewBytes += narSizes[p]
+			continue
+		}
+		s.ValidPaths++
+		s.ValidBytes += narSizes[p]
+	}
+	for _, o := range outputs {
+		status := outputPresent
+		for _, p := range outputPaths(o) {
+			if _, ok := invalid[p]; !ok {
+				continue
+			}
+			if _, ok := narSizes[p]; !ok {
+				status = outputMissing
+				break
+			}
+			status = outputNew
+		}
+		s.Outputs = append(s.Outputs, outputStatus{Output: o, Status: status})
+	}
+	return s
+}
+
+// outputPaths returns the realised store paths of the output, and its development environment, if any.
+func outputPaths(o manifest.Output) (paths []string) {
+	paths = slices.Sorted(maps.Values(o.StorePaths))
+	if o.Environment != "" {
+		paths = append(paths, o.Environment)
+	}
+	return paths
+}
+
+// dryRun reports how many of the store paths in the export are new to the local store, and how many are already
+// valid, and which outputs would become available, without importing anything. If paths is empty, every store path
+// in the export is reported.
+func dryRun(ctx context.Context, nixStorePath string, outputs []manifest.Output, paths []string, w io.Writer) (err error) {
+	narSizes := make(map[string]uint64)
+	err = manifest.WalkNarInfos(ctx, nixStorePath, func(fileName string, ni *narinfo.NarInfo) error {
+		narSizes[ni.StorePath] = ni.NarSize
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read narinfo files: %w", err)
+	}
+	if len(paths) == 0 {
+		paths = slices.Sorted(maps.Keys(narSizes))
+	}
+
+	query := slices.Clone(paths)
+	for _, o := range outputs {
+		query = append(query, outputPaths(o)...)
+	}
+	slices.Sort(query)
+	// nix-store --check-validity --print-invalid <paths>
+	invalidPaths, err := nixcmd.NixStoreInvalidPaths(io.Discard, os.Stderr, slices.Compact(query))
+	if err != nil {
+		return fmt.Errorf("failed to check the local store: %w", err)
+	}
+	s := summarise(narSizes, paths, invalidPaths, outputs)
+
+	fmt.Fprintf(w, "New paths: %d (%s)\n", s.NewPaths, humanize.Bytes(s.NewBytes))
+	fmt.Fprintf(w, "Already valid paths: %d (%s)\n", s.ValidPaths, humanize.Bytes(s.ValidBytes))
+	if len(s.Outputs) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAKE\tOUTPUT\tSYSTEM\tSTATUS")
+	for _, o := range s.Outputs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Output.Flake, o.Output.Name, o.Output.System, o.Status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,42 @@
+package importcmd
+
+import (
+	"testing"
+
+	"github.com/a-h/flakegap/manifest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummarise(t *testing.T) {
+	narSizes := map[string]uint64{
+		"/nix/store/a-glibc": 100,
+		"/nix/store/b-app":   20,
+		"/nix/store/c-bash":  5,
+	}
+	paths := []string{"/nix/store/a-glibc", "/nix/store/b-app", "/nix/store/c-bash"}
+	invalidPaths := []string{"/nix/store/b-app", "/nix/store/c-bash", "/nix/store/d-tool"}
+	outputs := []manifest.Output{
+		{Name: "packages.x86_64-linux.glibc", StorePaths: map[string]string{"out": "/nix/store/a-glibc"}},
+		{Name: "packages.x86_64-linux.default", StorePaths: map[string]string{"out": "/nix/store/b-app"}},
+		{Name: "packages.x86_64-linux.tool", StorePaths: map[string]string{"out": "/nix/store/d-tool"}},
+		{Name: "devShells.x86_64-linux.default", StorePaths: map[string]string{"out": "/nix/store/a-glibc"}, Environment: "/nix/store/c-bash"},
+	}
+
+	actual := summarise(narSizes, paths, invalidPaths, outputs)
+
+	expected := importSummary{
+		NewPaths:   2,
+		NewBytes:   25,
+		ValidPaths: 1,
+		ValidBytes: 100,
+		Outputs: []outputStatus{
+			{Output: outputs[0], Status: outputPresent},
+			{Output: outputs[1], Status: outputNew},
+			{Output: outputs[2], Status: outputMissing},
+			{Output: outputs[3], Status: outputNew},
+		},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
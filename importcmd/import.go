@@ -5,11 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 
 	"github.com/a-h/flakegap/archive"
+	"github.com/a-h/flakegap/manifest"
 	"github.com/a-h/flakegap/nixcmd"
+	"github.com/nix-community/go-nix/pkg/narinfo"
 )
 
 type Args struct {
@@ -17,6 +22,24 @@ type Args struct {
 	ImportFileName string
 	// TemporaryPath to export the files to.
 	TemporaryPath string
+	// SourceDest is a directory to restore the exported source code to. The contents of source/ are restored, so the
+	// flake is in SourceDest, or for workspace exports, the contents of sources/, so each flake is in SourceDest/<name>.
+	SourceDest string
+	// OutputsDest is a directory to restore the build outputs in outputs/ to.
+	OutputsDest string
+	// Outputs are glob patterns over the names of the outputs to import, e.g. devShells.x86_64-linux.default. Only the
+	// closures of the matching outputs are copied to the store. If empty, every store path in the export is copied.
+	Outputs []string
+	// DryRun reports which store paths in the export are new to the local store, and which outputs would become
+	// available, without importing anything.
+	DryRun bool
+	// GCRoots creates GC roots for the imported outputs and store paths in GCRootsDir/<bundle ID>/, so that they're not
+	// deleted by nix-collect-garbage.
+	GCRoots bool
+	// GCRootsDir is the directory to create GC roots in, defaults to gcroots.DefaultDir.
+	GCRootsDir string
+	// Force restores the source code and build outputs to directories that are not empty, overwriting existing files.
+	Force bool
 	// Help shows usage and quits.
 	Help bool
 }
@@ -26,6 +49,15 @@ func (a Args) Validate() error {
 	if a.ImportFileName == "" {
 		errs = append(errs, fmt.Errorf("import-filename is required"))
 	}
+	if _, err := nixcmd.NewOutputFilter(a.Outputs, nil); err != nil {
+		errs = append(errs, err)
+	}
+	if a.GCRoots && a.GCRootsDir == "" {
+		errs = append(errs, fmt.Errorf("gc-roots-dir is required"))
+	}
+	if a.SourceDest != "" && a.SourceDest == a.OutputsDest {
+		errs = append(errs, fmt.Errorf("source-dest and outputs-dest must be different directories"))
+	}
 	return errors.Join(errs...)
 }
 
@@ -41,6 +73,16 @@ func getTemporaryPath(log *slog.Logger, current string) (updated string) {
 }
 
 func Run(ctx context.Context, log *slog.Logger, args Args) (err error) {
+	// Check the destinations before extracting the archive, which can take a long time. A dry run doesn't write to them.
+	for _, dst := range []string{args.SourceDest, args.OutputsDest} {
+		if dst == "" || args.DryRun {
+			continue
+		}
+		if err = checkDest(dst, args.Force); err != nil {
+			return err
+		}
+	}
+
 	nixExportPath, err := os.MkdirTemp(getTemporaryPath(log, args.TemporaryPath), "flakegap")
 	if err != nil {
 		return fmt.Errorf("failed to create temp dir: %w", err)
@@ -56,14 +98,193 @@ func Run(ctx context.Context, log *slog.Logger, args Args) (err error) {
 		return fmt.Errorf("nix-store directory not found in extracted archive: %w", err)
 	}
 
+	em, err := manifest.Read(filepath.Join(nixExportPath, manifest.JSONFileName))
+	if err == nil {
+		log.Info("Read manifest", slog.String("id", em.ID), slog.Time("created", em.Created), slog.String("revision", em.Source.Revision), slog.String("closure", em.ClosureMode()), slog.Int("outputs", len(em.Outputs)), slog.Int("paths", len(em.Paths)))
+		for _, f := range em.Flakes {
+			log.Info("Read workspace flake", slog.String("flake", f.Name), slog.String("revision", f.Source.Revision), slog.String("source", f.FlakeDir()))
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	systems, err := manifest.Systems(nixExportPath)
+	if err != nil {
+		return err
+	}
+	hostSystem := nixcmd.HostSystem()
+	// Exports created before per-system manifests don't record their systems.
+	if len(systems) > 0 && !slices.Contains(systems, hostSystem) {
+		log.Warn("Export does not contain outputs for the host system", slog.String("system", hostSystem), slog.Any("systems", systems))
+	}
+
+	if err = checkBase(ctx, log, nixExportPath); err != nil {
+		return err
+	}
+
+	if args.GCRoots && em.ID == "" {
+		return fmt.Errorf("gc-roots requires the export to contain %s, re-export with a newer version of flakegap", manifest.JSONFileName)
+	}
+
+	outputs, paths := em.Outputs, []string(nil)
+	if len(args.Outputs) > 0 {
+		if em.Version == 0 {
+			return fmt.Errorf("output requires the export to contain %s, re-export with a newer version of flakegap, or import every output", manifest.JSONFileName)
+		}
+		filter, err := nixcmd.NewOutputFilter(args.Outputs, nil)
+		if err != nil {
+			return err
+		}
+		if outputs, paths, err = selectOutputs(em, filter); err != nil {
+			return err
+		}
+		for _, o := range outputs {
+			log.Info("Selected output", slog.String("output", o.Name), slog.String("flake", o.Flake), slog.String("reason", o.Reason))
+		}
+	}
+
+	if args.DryRun {
+		log.Info("Checking which store paths are already present", slog.String("nix-store", nixStorePath))
+		return dryRun(ctx, nixStorePath, outputs, paths, os.Stdout)
+	}
+
+	log.Info("Restoring Nix store from export", slog.String("nix-store", nixStorePath), slog.Int("paths", len(paths)))
+	if err = CopyStore(ctx, log, "", nixStorePath, paths); err != nil {
+		return err
+	}
+
+	if args.GCRoots {
+		if err = addGCRoots(log, args.GCRootsDir, em, outputs, paths); err != nil {
+			return err
+		}
+	}
+
+	if args.SourceDest != "" {
+		if err = restoreSource(log, nixExportPath, em, args.SourceDest); err != nil {
+			return err
+		}
+	}
+	if args.OutputsDest != "" {
+		log.Info("Restoring build outputs", slog.String("dest", args.OutputsDest))
+		outputsPath := filepath.Join(nixExportPath, "outputs")
+		if _, err := os.Stat(outputsPath); err != nil {
+			return fmt.Errorf("outputs directory not found in extracted archive: %w", err)
+		}
+		if err = restoreDir(outputsPath, args.OutputsDest); err != nil {
+			return fmt.Errorf("failed to restore build outputs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// restoreSource restores the source code of the export to dst, and logs the directory of each flake within it.
+func restoreSource(log *slog.Logger, nixExportPath string, m manifest.Manifest, dst string) (err error) {
+	sourcePath := filepath.Join(nixExportPath, "source")
+	flakeDirs := []string{filepath.Join(dst, filepath.FromSlash(m.Source.Dir))}
+	if len(m.Flakes) > 0 {
+		sourcePath = filepath.Join(nixExportPath, "sources")
+		flakeDirs = nil
+		for _, f := range m.Flakes {
+			flakeDirs = append(flakeDirs, filepath.Join(dst, filepath.FromSlash(f.Name), filepath.FromSlash(f.Source.Dir)))
+		}
+	}
+	if _, err := os.Stat(sourcePath); err != nil {
+		return fmt.Errorf("source directory not found in extracted archive: %w", err)
+	}
+	log.Info("Restoring source code", slog.String("dest", dst))
+	if err = restoreDir(sourcePath, dst); err != nil {
+		return fmt.Errorf("failed to restore source code: %w", err)
+	}
+	for _, dir := range flakeDirs {
+		log.Info("Restored flake", slog.String("dir", dir))
+	}
+	return nil
+}
+
+// CopyStore copies the store paths, and their closures, from the nix-store directory of an export to the local store.
+// If paths is empty, all of the store paths are copied. If Nix fails with https://github.com/NixOS/nix/issues/9052, the
+// paths that are missing from the local store are copied one at a time instead.
+func CopyStore(ctx context.Context, log *slog.Logger, codeDir, nixStorePath string, paths []string) (err error) {
 	sourceStore := fmt.Sprintf("file://%s", nixStorePath)
-	log.Info("Restoring Nix store from export", slog.String("nix-store", nixStorePath))
+	if len(paths) == 0 {
+		// nix copy --all --no-check-sigs --from file:///nix-export/nix-store/
+		// nix copy --all --derivation --no-check-sigs --from file:///nix-export/nix-store/
+		err = nixcmd.CopyFromAll(os.Stdout, os.Stderr, codeDir, sourceStore)
+	} else {
+		// nix copy --no-check-sigs --from file:///nix-export/nix-store/ <paths>
+		err = nixcmd.CopyPathsFrom(os.Stdout, os.Stderr, codeDir, sourceStore, paths...)
+	}
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nixcmd.ErrPathNotValid) {
+		return fmt.Errorf("failed to copy from %s: %w", nixStorePath, err)
+	}
+
+	log.Warn("Copying paths failed due to https://github.com/NixOS/nix/issues/9052, copying missing paths one at a time", slog.Any("error", err))
+	references, err := manifest.References(ctx, nixStorePath)
+	if err != nil {
+		return fmt.Errorf("failed to read narinfo files: %w", err)
+	}
+	graph := nixcmd.ClosureGraph(references)
+	if len(paths) > 0 {
+		graph = graph.Subgraph(paths...)
+	}
+	// nix copy --no-check-sigs --from file:///nix-export/nix-store/ <path>
+	retried, failed, err := nixcmd.CopyFromEach(os.Stdout, os.Stderr, codeDir, sourceStore, graph)
+	if err != nil {
+		return fmt.Errorf("failed to copy paths one at a time: %w", err)
+	}
+	log.Info("Copied missing paths one at a time", slog.Int("retried", len(retried)), slog.Int("failed", len(failed)))
+	if len(failed) > 0 {
+		paths := slices.Sorted(maps.Keys(failed))
+		for _, p := range paths {
+			log.Error("Failed to copy path", slog.String("path", p), slog.Any("error", failed[p]))
+		}
+		return fmt.Errorf("failed to copy %d of %d retried paths from %s, including %q", len(failed), len(retried), nixStorePath, paths[0])
+	}
+	return nil
+}
+
+// checkBase checks that the store paths of the base exports that a delta export depends on are present in the local store.
+func checkBase(ctx context.Context, log *slog.Logger, nixExportPath string) (err error) {
+	basePaths, err := manifest.ReadPathsFile(filepath.Join(nixExportPath, manifest.BaseFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read base manifest: %w", err)
+	}
+	base := make(map[string]struct{}, len(basePaths))
+	for _, p := range basePaths {
+		base[p] = struct{}{}
+	}
 
-	// nix copy --all --no-check-sigs --from file:///nix-export/nix-store/
-	// nix copy --all --derivation --no-check-sigs --from file:///nix-export/nix-store/
-	if err = nixcmd.CopyFromAll(os.Stdout, os.Stderr, "", sourceStore); err != nil {
-		return fmt.Errorf("failed to copy from /nix-export/nix-store: %w", err)
+	// Find the base paths referenced by the delta.
+	required := make(map[string]struct{})
+	err = manifest.WalkNarInfos(ctx, filepath.Join(nixExportPath, "nix-store"), func(fileName string, ni *narinfo.NarInfo) error {
+		storeDir := path.Dir(ni.StorePath)
+		for _, ref := range ni.References {
+			if p := path.Join(storeDir, ref); p != ni.StorePath {
+				if _, ok := base[p]; ok {
+					required[p] = struct{}{}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read narinfo files: %w", err)
 	}
 
+	log.Info("Export is a delta, checking that the base export has been imported", slog.Int("requiredPaths", len(required)))
+	invalidPaths, err := nixcmd.NixStoreInvalidPaths(os.Stdout, os.Stderr, slices.Sorted(maps.Keys(required)))
+	if err != nil {
+		return fmt.Errorf("failed to check base paths: %w", err)
+	}
+	if len(invalidPaths) > 0 {
+		return fmt.Errorf("the base export of this delta export has not been imported, %d required paths are missing, including %q", len(invalidPaths), invalidPaths[0])
+	}
 	return nil
 }
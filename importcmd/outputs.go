@@ -0,0 +1,86 @@
+package importcmd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+)
+
+// selectOutputs returns the outputs in the manifest that match the filter, and the store paths required to use them:
+// the closures of the outputs, the flake inputs of their flakes, and the shell tooling of the nixpkgs inputs for
+// their systems, which nix develop requires. The closures of build and sources exports include the derivations
+// required to rebuild the outputs.
+func selectOutputs(m manifest.Manifest, filter nixcmd.OutputFilter) (outputs []manifest.Output, paths []string, err error) {
+	type flakeSystem struct {
+		Flake  string
+		System string
+	}
+	names := make(map[string]struct{})
+	flakes := make(map[string]struct{})
+	systems := make(map[flakeSystem]struct{})
+	for _, o := range m.Outputs {
+		if !filter.Match(o.Name) {
+			continue
+		}
+		outputs = append(outputs, o)
+		names[o.Name] = struct{}{}
+		flakes[o.Flake] = struct{}{}
+		systems[flakeSystem{Flake: o.Flake, System: o.System}] = struct{}{}
+	}
+	if len(outputs) == 0 {
+		return nil, nil, fmt.Errorf("no outputs in the export match %v", filter.Include)
+	}
+	for _, o := range m.Outputs {
+		if _, ok := names[o.Name]; ok || o.Reason != manifest.ReasonNixpkgsInput {
+			continue
+		}
+		if _, ok := systems[flakeSystem{Flake: o.Flake, System: o.System}]; ok {
+			outputs = append(outputs, o)
+			names[o.Name] = struct{}{}
+		}
+	}
+
+	// Paths of workspace exports are only selected if they're required by the flakes of the selected outputs, since
+	// outputs of different flakes can have the same name. Extra installables and paths don't belong to a flake.
+	_, extraSelected := flakes[""]
+	requiredByFlake := func(p manifest.Path) bool {
+		if len(p.Flakes) == 0 || extraSelected {
+			return true
+		}
+		return slices.ContainsFunc(p.Flakes, func(flake string) bool {
+			_, ok := flakes[flake]
+			return ok
+		})
+	}
+	flakeInputs := make(map[string]struct{}, len(m.FlakeInputs))
+	for _, p := range m.FlakeInputs {
+		flakeInputs[p] = struct{}{}
+	}
+	graph := make(nixcmd.ClosureGraph, len(m.Paths))
+	var roots []string
+	for _, p := range m.Paths {
+		graph[p.StorePath] = p.References
+		if !requiredByFlake(p) {
+			continue
+		}
+		_, isFlakeInput := flakeInputs[p.StorePath]
+		isOutputPath := slices.ContainsFunc(p.Outputs, func(name string) bool {
+			_, ok := names[name]
+			return ok
+		})
+		if isFlakeInput || isOutputPath {
+			roots = append(roots, p.StorePath)
+		}
+	}
+	// Include the references of the paths, so that the closures are complete, even if the manifest doesn't list
+	// every path of an output.
+	for _, p := range graph.Closure(roots...) {
+		// Paths outside of the export, such as the paths of the base exports of a delta export, are already in the store.
+		if _, ok := graph[p]; ok {
+			paths = append(paths, p)
+		}
+	}
+	return outputs, paths, nil
+}
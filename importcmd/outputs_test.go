@@ -0,0 +1,90 @@
+package importcmd
+
+import (
+	"testing"
+
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSelectOutputs(t *testing.T) {
+	m := manifest.Manifest{
+		Version: manifest.Version,
+		Outputs: []manifest.Output{
+			{Name: "nixpkgs#legacyPackages.x86_64-linux.bashInteractive", System: "x86_64-linux", Reason: manifest.ReasonNixpkgsInput},
+			{Name: "nixpkgs#legacyPackages.aarch64-linux.bashInteractive", System: "aarch64-linux", Reason: manifest.ReasonNixpkgsInput},
+			{Name: "devShells.x86_64-linux.default", System: "x86_64-linux", Reason: manifest.ReasonFlakeOutput},
+			{Name: "packages.x86_64-linux.default", System: "x86_64-linux", Reason: manifest.ReasonFlakeOutput},
+		},
+		FlakeInputs: []string{"/nix/store/a-source", "/nix/store/b-nixpkgs-source"},
+		Paths: []manifest.Path{
+			{StorePath: "/nix/store/a-source"},
+			{StorePath: "/nix/store/b-nixpkgs-source"},
+			{StorePath: "/nix/store/c-bash", References: []string{"/nix/store/d-glibc"}, Outputs: []string{"nixpkgs#legacyPackages.x86_64-linux.bashInteractive"}},
+			{StorePath: "/nix/store/d-glibc", Outputs: []string{"nixpkgs#legacyPackages.x86_64-linux.bashInteractive", "devShells.x86_64-linux.default", "packages.x86_64-linux.default"}},
+			{StorePath: "/nix/store/e-bash-aarch64", Outputs: []string{"nixpkgs#legacyPackages.aarch64-linux.bashInteractive"}},
+			{StorePath: "/nix/store/f-shell.drv", References: []string{"/nix/store/g-go", "/nix/store/z-base"}, Outputs: []string{"devShells.x86_64-linux.default"}},
+			{StorePath: "/nix/store/g-go", References: []string{"/nix/store/d-glibc"}},
+			{StorePath: "/nix/store/h-app", References: []string{"/nix/store/d-glibc"}, Outputs: []string{"packages.x86_64-linux.default"}},
+		},
+	}
+	filter, err := nixcmd.NewOutputFilter([]string{"devShells.*.default"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create filter: %v", err)
+	}
+	outputs, paths, err := selectOutputs(m, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, o := range outputs {
+		names = append(names, o.Name)
+	}
+	expectedNames := []string{"devShells.x86_64-linux.default", "nixpkgs#legacyPackages.x86_64-linux.bashInteractive"}
+	if diff := cmp.Diff(expectedNames, names); diff != "" {
+		t.Errorf("unexpected outputs:\n%s", diff)
+	}
+	expectedPaths := []string{
+		"/nix/store/a-source",
+		"/nix/store/b-nixpkgs-source",
+		"/nix/store/c-bash",
+		"/nix/store/d-glibc",
+		"/nix/store/f-shell.drv",
+		"/nix/store/g-go",
+	}
+	if diff := cmp.Diff(expectedPaths, paths); diff != "" {
+		t.Errorf("unexpected paths:\n%s", diff)
+	}
+
+	t.Run("no matching outputs is an error", func(t *testing.T) {
+		filter, _ := nixcmd.NewOutputFilter([]string{"checks.*.*"}, nil)
+		if _, _, err := selectOutputs(m, filter); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestSelectOutputsWorkspace(t *testing.T) {
+	m := manifest.Manifest{
+		Version: manifest.Version,
+		Outputs: []manifest.Output{
+			{Name: "packages.x86_64-linux.default", Flake: "api", System: "x86_64-linux", Reason: manifest.ReasonFlakeOutput},
+			{Name: "packages.x86_64-linux.default", Flake: "web", System: "x86_64-linux", Reason: manifest.ReasonFlakeOutput},
+			{Name: "devShells.x86_64-linux.default", Flake: "web", System: "x86_64-linux", Reason: manifest.ReasonFlakeOutput},
+		},
+		Paths: []manifest.Path{
+			{StorePath: "/nix/store/a-api", Outputs: []string{"packages.x86_64-linux.default"}, Flakes: []string{"api"}},
+			{StorePath: "/nix/store/b-web", Outputs: []string{"packages.x86_64-linux.default"}, Flakes: []string{"web"}},
+			{StorePath: "/nix/store/c-glibc", Outputs: []string{"packages.x86_64-linux.default", "devShells.x86_64-linux.default"}, Flakes: []string{"api", "web"}},
+		},
+	}
+	filter, _ := nixcmd.NewOutputFilter([]string{"devShells.*.*"}, nil)
+	_, paths, err := selectOutputs(m, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"/nix/store/c-glibc"}, paths); diff != "" {
+		t.Error(diff)
+	}
+}
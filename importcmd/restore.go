@@ -0,0 +1,85 @@
+package importcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// checkDest returns an error if dst is a non-empty directory, unless force is set, so that restoring to it doesn't
+// overwrite existing files by mistake.
+func checkDest(dst string, force bool) error {
+	entries, err := os.ReadDir(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", dst, err)
+	}
+	if len(entries) > 0 && !force {
+		return fmt.Errorf("%q is not empty, use -force to overwrite it", dst)
+	}
+	return nil
+}
+
+// restoreDir copies the contents of src to dst, overwriting existing files. Files in dst that are not in src are
+// kept. Symlinks are copied as symlinks.
+func restoreDir(src, dst string) error {
+	return filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			if err = os.RemoveAll(target); err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return restoreFile(name, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func restoreFile(src, dst string, perm fs.FileMode) (err error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Remove the existing file, which may be read-only, or a symlink to a file outside of dst.
+	if err = os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := w.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,77 @@
+package importcmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDest(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkDest(filepath.Join(dir, "missing"), false); err != nil {
+		t.Errorf("expected missing directory to be valid, got %v", err)
+	}
+	if err := checkDest(dir, false); err != nil {
+		t.Errorf("expected empty directory to be valid, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "flake.nix"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDest(dir, false); err == nil {
+		t.Error("expected non-empty directory to be an error")
+	}
+	if err := checkDest(dir, true); err != nil {
+		t.Errorf("expected non-empty directory to be valid when forced, got %v", err)
+	}
+}
+
+func TestRestoreDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"flake.nix":   "new",
+		"app/main.go": "package main",
+	}
+	for name, content := range files {
+		fileName := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("app/main.go", filepath.Join(src, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	// Existing files are overwritten, even if they're read-only, and other files are kept.
+	if err := os.WriteFile(filepath.Join(dst, "flake.nix"), []byte("old"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "local.txt"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreDir(src, dst); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+
+	expected := map[string]string{
+		"flake.nix":   "new",
+		"app/main.go": "package main",
+		"main.go":     "package main",
+		"local.txt":   "local",
+	}
+	for name, content := range expected {
+		actual, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("failed to read %q: %v", name, err)
+			continue
+		}
+		if string(actual) != content {
+			t.Errorf("%q: expected %q, got %q", name, content, actual)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "main.go")); err != nil || link != "app/main.go" {
+		t.Errorf("expected main.go to be a symlink to app/main.go, got %q, %v", link, err)
+	}
+}
@@ -0,0 +1,122 @@
+package importcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/a-h/flakegap/gcroots"
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
+)
+
+// addGCRoots creates GC roots for the imported store paths, so that nix-collect-garbage doesn't delete any of them.
+// Each output, and the development environment of each devShell of a runtime export, has a named root. The rest of the
+// imported paths, such as derivations, the build inputs of devShells, and flake inputs, are kept alive by rooting
+// every imported path that no other imported path refers to, since their closures contain every imported path. If
+// paths is empty, every path in the export was imported. Store paths that are not valid in the local store, such as
+// the outputs of sources exports, which haven't been built, are skipped.
+func addGCRoots(log *slog.Logger, dir string, m manifest.Manifest, outputs []manifest.Output, paths []string) (err error) {
+	importedPaths := m.Paths
+	if len(paths) > 0 {
+		selected := make(map[string]struct{}, len(paths))
+		for _, p := range paths {
+			selected[p] = struct{}{}
+		}
+		importedPaths = slices.DeleteFunc(slices.Clone(m.Paths), func(p manifest.Path) bool {
+			_, ok := selected[p.StorePath]
+			return !ok
+		})
+	}
+	roots, pathRoots := getGCRoots(outputs, importedPaths)
+	storePaths := slices.Clone(pathRoots)
+	for _, r := range roots {
+		storePaths = append(storePaths, r.StorePath)
+	}
+	// nix-store --check-validity --print-invalid <paths>
+	invalidPaths, err := nixcmd.NixStoreInvalidPaths(io.Discard, os.Stderr, storePaths)
+	if err != nil {
+		return fmt.Errorf("failed to check the local store: %w", err)
+	}
+	var added int
+	for _, r := range roots {
+		if slices.Contains(invalidPaths, r.StorePath) {
+			log.Warn("Output is not in the local store, skipping GC root", slog.String("root", r.Name), slog.String("storePath", r.StorePath))
+			continue
+		}
+		if err = gcroots.Add(dir, m.ID, r.Name, r.StorePath); err != nil {
+			return gcRootsError(err)
+		}
+		added++
+	}
+	for _, p := range pathRoots {
+		if slices.Contains(invalidPaths, p) {
+			log.Warn("Store path is not in the local store, skipping GC root", slog.String("storePath", p))
+			continue
+		}
+		if err = gcroots.AddPath(dir, m.ID, p); err != nil {
+			return gcRootsError(err)
+		}
+		added++
+	}
+	log.Info("Added GC roots", slog.String("dir", dir), slog.String("bundle", m.ID), slog.Int("roots", added))
+	return nil
+}
+
+func gcRootsError(err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w, run as root, or use -gc-roots-dir to create GC roots in a directory you can write to", err)
+	}
+	return err
+}
+
+// getGCRoots returns the named GC roots of the outputs, and the imported store paths that no other imported path
+// refers to, other than the store paths of the named roots.
+//
+// Roots are named after the output, with the workspace flake name as a prefix, e.g.
+// api#packages.x86_64-linux.default. Store paths of outputs other than out are suffixed with the output name, and
+// development environments with -env.
+func getGCRoots(outputs []manifest.Output, paths []manifest.Path) (roots []gcroots.Root, pathRoots []string) {
+	rooted := make(map[string]struct{})
+	for _, o := range outputs {
+		name := o.Name
+		if o.Flake != "" {
+			name = o.Flake + "#" + name
+		}
+		for _, outputName := range slices.Sorted(maps.Keys(o.StorePaths)) {
+			rootName := name
+			if outputName != "out" {
+				rootName += "-" + outputName
+			}
+			roots = append(roots, gcroots.Root{Name: rootName, StorePath: o.StorePaths[outputName]})
+			rooted[o.StorePaths[outputName]] = struct{}{}
+		}
+		if o.Environment != "" {
+			roots = append(roots, gcroots.Root{Name: name + "-env", StorePath: o.Environment})
+			rooted[o.Environment] = struct{}{}
+		}
+	}
+
+	referenced := make(map[string]struct{})
+	for _, p := range paths {
+		for _, ref := range p.References {
+			if ref != p.StorePath {
+				referenced[ref] = struct{}{}
+			}
+		}
+	}
+	for _, p := range paths {
+		_, isReferenced := referenced[p.StorePath]
+		_, isRooted := rooted[p.StorePath]
+		if !isReferenced && !isRooted {
+			pathRoots = append(pathRoots, p.StorePath)
+		}
+	}
+	slices.Sort(pathRoots)
+	return roots, pathRoots
+}
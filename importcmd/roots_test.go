@@ -0,0 +1,116 @@
+package importcmd
+
+import (
+	"testing"
+
+	"github.com/a-h/flakegap/gcroots"
+	"github.com/a-h/flakegap/manifest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetGCRoots(t *testing.T) {
+	tests := []struct {
+		name              string
+		outputs           []manifest.Output
+		paths             []manifest.Path
+		expectedRoots     []gcroots.Root
+		expectedPathRoots []string
+	}{
+		{
+			name: "build closures root derivations, build inputs and flake inputs",
+			outputs: []manifest.Output{
+				{
+					Name:       "packages.x86_64-linux.default",
+					StorePaths: map[string]string{"out": "/nix/store/a-app", "man": "/nix/store/b-app-man"},
+				},
+				{
+					Name:       "devShells.x86_64-linux.default",
+					Flake:      "services/api",
+					StorePaths: map[string]string{"out": "/nix/store/c-shell"},
+				},
+			},
+			paths: []manifest.Path{
+				{StorePath: "/nix/store/a-app", References: []string{"/nix/store/a-app", "/nix/store/d-glibc"}},
+				{StorePath: "/nix/store/b-app-man"},
+				{StorePath: "/nix/store/c-shell", References: []string{"/nix/store/d-glibc"}},
+				{StorePath: "/nix/store/d-glibc"},
+				{StorePath: "/nix/store/e-app.drv", References: []string{"/nix/store/f-src", "/nix/store/g-go.drv"}},
+				{StorePath: "/nix/store/f-src"},
+				{StorePath: "/nix/store/g-go.drv"},
+				// The outputs of build inputs aren't referred to by the derivations that use them.
+				{StorePath: "/nix/store/h-go", References: []string{"/nix/store/d-glibc"}},
+				{StorePath: "/nix/store/i-shell.drv", References: []string{"/nix/store/g-go.drv"}},
+				{StorePath: "/nix/store/j-flake-source"},
+			},
+			expectedRoots: []gcroots.Root{
+				{Name: "packages.x86_64-linux.default-man", StorePath: "/nix/store/b-app-man"},
+				{Name: "packages.x86_64-linux.default", StorePath: "/nix/store/a-app"},
+				{Name: "services/api#devShells.x86_64-linux.default", StorePath: "/nix/store/c-shell"},
+			},
+			expectedPathRoots: []string{
+				"/nix/store/e-app.drv",
+				"/nix/store/h-go",
+				"/nix/store/i-shell.drv",
+				"/nix/store/j-flake-source",
+			},
+		},
+		{
+			name: "runtime closures root outputs, development environments and flake inputs",
+			outputs: []manifest.Output{
+				{
+					Name:        "devShells.x86_64-linux.default",
+					StorePaths:  map[string]string{"out": "/nix/store/c-shell"},
+					Environment: "/nix/store/k-shell-env",
+				},
+			},
+			paths: []manifest.Path{
+				{StorePath: "/nix/store/c-shell", References: []string{"/nix/store/d-glibc"}},
+				{StorePath: "/nix/store/d-glibc"},
+				{StorePath: "/nix/store/h-go", References: []string{"/nix/store/d-glibc"}},
+				{StorePath: "/nix/store/k-shell-env", References: []string{"/nix/store/h-go"}},
+				{StorePath: "/nix/store/j-flake-source"},
+			},
+			expectedRoots: []gcroots.Root{
+				{Name: "devShells.x86_64-linux.default", StorePath: "/nix/store/c-shell"},
+				{Name: "devShells.x86_64-linux.default-env", StorePath: "/nix/store/k-shell-env"},
+			},
+			expectedPathRoots: []string{
+				"/nix/store/j-flake-source",
+			},
+		},
+		{
+			name: "sources closures root derivations and flake inputs, since outputs aren't imported",
+			outputs: []manifest.Output{
+				{
+					Name:       "packages.x86_64-linux.default",
+					StorePaths: map[string]string{"out": "/nix/store/a-app"},
+				},
+			},
+			paths: []manifest.Path{
+				{StorePath: "/nix/store/e-app.drv", References: []string{"/nix/store/f-src", "/nix/store/g-go.drv"}},
+				{StorePath: "/nix/store/f-src"},
+				{StorePath: "/nix/store/g-go.drv", References: []string{"/nix/store/l-go-src"}},
+				{StorePath: "/nix/store/l-go-src"},
+				{StorePath: "/nix/store/j-flake-source"},
+			},
+			expectedRoots: []gcroots.Root{
+				{Name: "packages.x86_64-linux.default", StorePath: "/nix/store/a-app"},
+			},
+			expectedPathRoots: []string{
+				"/nix/store/e-app.drv",
+				"/nix/store/j-flake-source",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roots, pathRoots := getGCRoots(test.outputs, test.paths)
+			if diff := cmp.Diff(test.expectedRoots, roots); diff != "" {
+				t.Errorf("unexpected roots:\n%s", diff)
+			}
+			if diff := cmp.Diff(test.expectedPathRoots, pathRoots); diff != "" {
+				t.Errorf("unexpected path roots:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package manifest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// JSONFileName is the name of the machine-readable manifest of the export.
+const JSONFileName = "manifest.json"
+
+// Version of the manifest format. Increment when making breaking changes to the Manifest type.
+const Version = 1
+
+// Closure modes control which store paths are exported for each output.
+const (
+	// ClosureBuild exports the build closure of each output, so that every output can be rebuilt from source.
+	ClosureBuild = "build"
+	// ClosureRuntime exports the runtime closure of each output and the environments of devShells, so that outputs
+	// can be used, but not rebuilt.
+	ClosureRuntime = "runtime"
+	// ClosureSources exports the derivations of each output and the outputs of fixed-output derivations, such as source
+	// tarballs, but no built outputs, so that every output has to be rebuilt from source.
+	ClosureSources = "sources"
+)
+
+// Reasons that an output was included in the export.
+const (
+	// ReasonFlakeOutput is an output of the flake, e.g. packages.x86_64-linux.default.
+	ReasonFlakeOutput = "flake-output"
+	// ReasonNixpkgsInput is shell tooling from a flake input that provides legacyPackages, required by nix develop.
+	ReasonNixpkgsInput = "nixpkgs-input"
+	// ReasonExtraInstallable is an installable passed to export with -extra-installable.
+	ReasonExtraInstallable = "extra-installable"
+	// ReasonExtraPath is a store path passed to export with -extra-path.
+	ReasonExtraPath = "extra-path"
+)
+
+// Manifest is an inventory of the contents of an export.
+type Manifest struct {
+	// Version of the manifest format.
+	Version int `json:"version"`
+	// ID uniquely identifies the export.
+	ID string `json:"id"`
+	// Created is the time that the export was created.
+	Created time.Time `json:"created"`
+	// Flakegap is the version of flakegap that created the export.
+	Flakegap string `json:"flakegap"`
+	// Nix is the version of Nix that created the export.
+	Nix string `json:"nix"`
+	// Systems are the Nix systems that were exported, e.g. x86_64-linux.
+	Systems []string `json:"systems"`
+	// Closure is the closure mode of the export, e.g. build, runtime or sources. Empty for exports that predate closure modes,
+	// which are build exports.
+	Closure string `json:"closure,omitempty"`
+	// Include are the glob patterns of output attribute paths that were exported, e.g. packages.*.default. Validate
+	// builds the same outputs unless other patterns are given.
+	Include []string `json:"include,omitempty"`
+	// Exclude are the glob patterns of output attribute paths that were skipped, e.g. packages.*.*-docker-image.
+	Exclude []string `json:"exclude,omitempty"`
+	// Source describes the flake source code. Empty for workspace exports, which describe each flake in Flakes.
+	Source Source `json:"source"`
+	// Flakes are the flakes of a workspace export, which exports several flakes to a single bundle, with the source
+	// code of each flake in sources/<name>. Empty for exports of a single flake.
+	Flakes []Flake `json:"flakes,omitempty"`
+	// Outputs that were exported.
+	Outputs []Output `json:"outputs"`
+	// FlakeInputs are the store paths of the flake source and its inputs, copied by `nix flake archive`.
+	FlakeInputs []string `json:"flakeInputs,omitempty"`
+	// Paths are the store paths in the export.
+	Paths []Path `json:"paths"`
+}
+
+// Source describes the flake source code that was exported.
+type Source struct {
+	// Revision is the git commit of the source code, if the source code is in a git repository.
+	Revision string `json:"revision,omitempty"`
+	// FlakeRef is the flake reference that was exported, if the export was created with -flake, e.g.
+	// github:a-h/flakegap/v0.0.1.
+	FlakeRef string `json:"flakeRef,omitempty"`
+	// Rev is the git ref that was checked out to export, e.g. v1.2.0, if the export was created with -rev.
+	Rev string `json:"rev,omitempty"`
+	// Branch is the git branch that was checked out, if any.
+	Branch string `json:"branch,omitempty"`
+	// Dirty is true if tracked files had uncommitted changes, or, when files ignored by .gitignore are left out of the
+	// export, if there were untracked files that are not ignored, which are included in the export.
+	Dirty bool `json:"dirty,omitempty"`
+	// Flake is the metadata of the flake, from `nix flake metadata`.
+	Flake *FlakeMetadata `json:"flake,omitempty"`
+	// FlakeLock is the content of the flake.lock file.
+	FlakeLock json.RawMessage `json:"flakeLock,omitempty"`
+	// Dir is the slash separated directory of the flake within source/, or sources/<name>/ for workspace flakes. It's
+	// empty if the flake is at the root of the directory, and is only set when path inputs outside of the flake directory are exported alongside it.
+	Dir string `json:"dir,omitempty"`
+	// GitBundles are the slash separated paths of the git bundles of the repository and its submodules within the
+	// export, e.g. git/repo.bundle. Only set if the export was created with -git-bundle.
+	GitBundles []string `json:"gitBundles,omitempty"`
+	// PathInputs are the flake inputs that refer to directories relative to the flake, e.g. "path:../shared".
+	PathInputs []PathInput `json:"pathInputs,omitempty"`
+}
+
+// FlakeMetadata is the locked reference of the flake, as resolved by Nix.
+type FlakeMetadata struct {
+	// URL is the locked URL of the flake.
+	URL string `json:"url"`
+	// NarHash is the hash of the NAR serialisation of the flake source.
+	NarHash string `json:"narHash,omitempty"`
+	// StorePath is the store path of the flake source.
+	StorePath string `json:"storePath,omitempty"`
+	// LastModified is the time of the commit, or of the most recently modified file, as a Unix timestamp.
+	LastModified int64 `json:"lastModified,omitempty"`
+}
+
+// PathInput is a flake input that refers to a directory relative to the flake, which is exported within source/.
+type PathInput struct {
+	// Name is the input path, e.g. shared.
+	Name string `json:"name"`
+	// Path of the input, slash separated and relative to the flake directory, e.g. ../shared.
+	Path string `json:"path"`
+}
+
+// FlakeDir returns the slash separated path of the flake directory within the export, e.g. source or source/app.
+func (s Source) FlakeDir() string {
+	return path.Join("source", s.Dir)
+}
+
+// Flake is a flake of a workspace export.
+type Flake struct {
+	// Name of the flake, e.g. services/api, which is also its directory within sources/.
+	Name string `json:"name"`
+	// Source describes the flake source code.
+	Source Source `json:"source"`
+}
+
+// FlakeDir returns the slash separated path of the flake directory within the export, e.g. sources/api or
+// sources/api/app.
+func (f Flake) FlakeDir() string {
+	return path.Join("sources", f.Name, f.Source.Dir)
+}
+
+// Output is an installable that was exported.
+type Output struct {
+	// Name of the output, e.g. packages.x86_64-linux.default. Outputs of flake inputs are prefixed with the input
+	// name, e.g. nixpkgs#legacyPackages.x86_64-linux.bashInteractive.
+	Name string `json:"name"`
+	// Flake is the name of the workspace flake that the output belongs to. Empty for exports of a single flake, and for
+	// extra installables and paths.
+	Flake string `json:"flake,omitempty"`
+	// System the output was built for, e.g. x86_64-linux. Empty for extra installables and paths, which are not
+	// specific to an exported system.
+	System string `json:"system,omitempty"`
+	// Installable used to build the output, e.g. .#packages.x86_64-linux.default.
+	Installable string `json:"installable"`
+	// Reason the output was included in the export, e.g. flake-output or extra-installable.
+	Reason string `json:"reason,omitempty"`
+	// StorePaths are the realised store paths of the output, keyed by output name, e.g. out, dev.
+	StorePaths map[string]string `json:"storePaths,omitempty"`
+	// Environment is the store path of the development environment of a devShell, saved by `nix develop --profile`.
+	// Only set for runtime exports, where it can be entered with `nix develop <environment>`.
+	Environment string `json:"environment,omitempty"`
+}
+
+// ClosureMode returns the closure mode of the export, defaulting to ClosureBuild.
+func (m Manifest) ClosureMode() string {
+	if m.Closure == "" {
+		return ClosureBuild
+	}
+	return m.Closure
+}
+
+// Path is a store path in the export, with the metadata taken from its narinfo file.
+type Path struct {
+	// StorePath, e.g. /nix/store/<hash>-<name>.
+	StorePath string `json:"storePath"`
+	// NarHash is the hash of the NAR serialisation of the path.
+	NarHash string `json:"narHash"`
+	// NarSize is the size of the NAR serialisation of the path, in bytes.
+	NarSize uint64 `json:"narSize"`
+	// References are the store paths that the path refers to.
+	References []string `json:"references,omitempty"`
+	// Deriver is the store path of the derivation that produced the path.
+	Deriver string `json:"deriver,omitempty"`
+	// Outputs are the names of the outputs that require the path.
+	Outputs []string `json:"outputs,omitempty"`
+	// Flakes are the names of the workspace flakes that require the path.
+	Flakes []string `json:"flakes,omitempty"`
+}
+
+// NewID returns a random export ID.
+func NewID() (id string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return id, fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Write the manifest to fileName.
+func Write(fileName string, m Manifest) (err error) {
+	w, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest file: %w", err)
+	}
+	defer w.Close()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(m); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Read the manifest from fileName.
+func Read(fileName string) (m Manifest, err error) {
+	r, err := os.Open(fileName)
+	if err != nil {
+		return m, err
+	}
+	defer r.Close()
+	if err = json.NewDecoder(r).Decode(&m); err != nil {
+		return m, fmt.Errorf("failed to parse manifest %q: %w", fileName, err)
+	}
+	if m.Version > Version {
+		return m, fmt.Errorf("manifest %q has version %d, but this version of flakegap only supports up to version %d", fileName, m.Version, Version)
+	}
+	return m, nil
+}
@@ -0,0 +1,125 @@
+package manifest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nix-community/go-nix/pkg/narinfo"
+)
+
+// FileName is the name of the manifest that lists every store path in the export.
+const FileName = "nix-export.txt"
+
+// BaseFileName is the name of the manifest that lists the store paths of the exports that a delta export was created from.
+// The store paths are not included in the delta export, so they must already be present in the store it's imported into.
+const BaseFileName = "nix-export-base.txt"
+
+// SystemFileName returns the name of the manifest that lists the store paths exported for a Nix system, e.g. "x86_64-linux".
+func SystemFileName(system string) string {
+	return fmt.Sprintf("nix-export-%s.txt", system)
+}
+
+// Systems returns the Nix systems that have a manifest in the export directory. The base manifest of delta exports
+// matches the same pattern, so it's skipped.
+func Systems(nixExportPath string) (systems []string, err error) {
+	matches, err := filepath.Glob(filepath.Join(nixExportPath, SystemFileName("*")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list system manifests: %w", err)
+	}
+	for _, m := range matches {
+		name := filepath.Base(m)
+		if name == BaseFileName {
+			continue
+		}
+		systems = append(systems, strings.TrimSuffix(strings.TrimPrefix(name, "nix-export-"), ".txt"))
+	}
+	slices.Sort(systems)
+	return systems, nil
+}
+
+// WritePaths writes the store paths to the file, one per line.
+func WritePaths(fileName string, paths []string) (err error) {
+	w, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest file: %w", err)
+	}
+	defer w.Close()
+	for _, p := range paths {
+		if _, err = fmt.Fprintf(w, "%s\n", p); err != nil {
+			return fmt.Errorf("failed to write store path %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// ReadPaths reads the store paths from a manifest written by WritePaths.
+func ReadPaths(r io.Reader) (paths []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
+
+// ReadPathsFile reads the store paths from a manifest file written by WritePaths.
+func ReadPathsFile(fileName string) (paths []string, err error) {
+	r, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadPaths(r)
+}
+
+// WalkNarInfos calls fn for each .narinfo file within dir.
+func WalkNarInfos(ctx context.Context, dir string, fn func(fileName string, ni *narinfo.NarInfo) error) (err error) {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if cancel := ctx.Err(); cancel != nil {
+			return cancel
+		}
+		if err != nil {
+			return err
+		}
+
+		if filepath.Ext(path) != ".narinfo" || d.IsDir() {
+			return nil
+		}
+
+		r, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %q: %w", path, err)
+		}
+		defer r.Close()
+		ni, err := narinfo.Parse(r)
+		if err != nil {
+			return fmt.Errorf("failed to parse narinfo %q: %w", path, err)
+		}
+		return fn(path, ni)
+	})
+}
+
+// References returns the store paths of the narinfo files within dir, and the store paths that each refers to.
+func References(ctx context.Context, dir string) (references map[string][]string, err error) {
+	references = make(map[string][]string)
+	err = WalkNarInfos(ctx, dir, func(fileName string, ni *narinfo.NarInfo) error {
+		storeDir := path.Dir(ni.StorePath)
+		refs := make([]string, len(ni.References))
+		for i, ref := range ni.References {
+			refs[i] = path.Join(storeDir, ref)
+		}
+		references[ni.StorePath] = refs
+		return nil
+	})
+	return references, err
+}
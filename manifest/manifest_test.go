@@ -0,0 +1,26 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSystems(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{FileName, BaseFileName, SystemFileName("x86_64-linux"), SystemFileName("aarch64-darwin")} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	systems, err := Systems(dir)
+	if err != nil {
+		t.Fatalf("failed to list systems: %v", err)
+	}
+	expected := []string{"aarch64-darwin", "x86_64-linux"}
+	if diff := cmp.Diff(expected, systems); diff != "" {
+		t.Error(diff)
+	}
+}
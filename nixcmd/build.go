@@ -1,25 +1,62 @@
 package nixcmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
 )
 
+// BuildResult is an entry in the output of `nix build --json`.
+type BuildResult struct {
+	// DrvPath is the derivation that was built.
+	DrvPath string `json:"drvPath"`
+	// Outputs maps the output names of the derivation, e.g. out, dev, lib to their store paths.
+	Outputs map[string]string `json:"outputs"`
+}
+
 // Build the flake reference that can be found in codeDir.
-func Build(stdout, stderr io.Writer, codeDir, ref string) (err error) {
+// Build doesn't create a result symlink, instead it returns the realised output paths.
+//
+//	nix build --no-link --json <ref>
+func Build(ctx context.Context, stdout, stderr io.Writer, codeDir, ref string) (results []BuildResult, err error) {
 	nixPath, err := exec.LookPath("nix")
 	if err != nil {
-		return fmt.Errorf("failed to find nix on path: %v", err)
+		return results, fmt.Errorf("failed to find nix on path: %v", err)
 	}
 
 	// Execute.
-	cmd := exec.Command(nixPath, "build", ref)
+	stdoutBuffer := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, nixPath, "build", "--no-link", "--json", ref)
 	cmd.Env = getEnv()
 	cmd.Dir = codeDir
 
 	w, closer := ErrorBuffer(stdout, stderr)
 	cmd.Stderr = w
-	cmd.Stdout = w
-	return closer(cmd.Run())
+	cmd.Stdout = stdoutBuffer
+	if err = closer(cmd.Run()); err != nil {
+		return results, err
+	}
+	return getBuildResults(stdoutBuffer.Bytes())
+}
+
+func getBuildResults(stdout []byte) (results []BuildResult, err error) {
+	var op []struct {
+		BuildResult
+		// Path is set instead of DrvPath and Outputs when the installable is a store path that isn't a derivation.
+		Path string `json:"path"`
+	}
+	if err = json.Unmarshal(stdout, &op); err != nil {
+		return results, fmt.Errorf("failed to parse nix build output: %w", err)
+	}
+	results = make([]BuildResult, len(op))
+	for i, r := range op {
+		results[i] = r.BuildResult
+		if r.Path != "" {
+			results[i].Outputs = map[string]string{"out": r.Path}
+		}
+	}
+	return results, nil
 }
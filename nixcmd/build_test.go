@@ -0,0 +1,77 @@
+package nixcmd
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		stdout   string
+		expected []BuildResult
+	}{
+		{
+			name: "single output",
+			stdout: `[{
+  "drvPath": "/nix/store/8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv",
+  "outputs": {
+    "out": "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1"
+  }
+}]`,
+			expected: []BuildResult{
+				{
+					DrvPath: "/nix/store/8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv",
+					Outputs: map[string]string{
+						"out": "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1",
+					},
+				},
+			},
+		},
+		{
+			name: "multiple outputs",
+			stdout: `[{
+  "drvPath": "/nix/store/0x6mjqhpgf0s3a0l8rsmwbvqrfmqpwqz-openssl-3.0.14.drv",
+  "outputs": {
+    "bin": "/nix/store/xc1ylmfc5d6bnxr4i1xqyk3hh47b6gv4-openssl-3.0.14-bin",
+    "dev": "/nix/store/9cbsq4xiwrsn2v9vv1vd7c8j1nf2i3jp-openssl-3.0.14-dev",
+    "out": "/nix/store/fg5vmkpz7wzxaw3shq1a6l0n9ls0g8vj-openssl-3.0.14"
+  }
+}]`,
+			expected: []BuildResult{
+				{
+					DrvPath: "/nix/store/0x6mjqhpgf0s3a0l8rsmwbvqrfmqpwqz-openssl-3.0.14.drv",
+					Outputs: map[string]string{
+						"bin": "/nix/store/xc1ylmfc5d6bnxr4i1xqyk3hh47b6gv4-openssl-3.0.14-bin",
+						"dev": "/nix/store/9cbsq4xiwrsn2v9vv1vd7c8j1nf2i3jp-openssl-3.0.14-dev",
+						"out": "/nix/store/fg5vmkpz7wzxaw3shq1a6l0n9ls0g8vj-openssl-3.0.14",
+					},
+				},
+			},
+		},
+		{
+			name:   "store path",
+			stdout: `[{"path": "/nix/store/b5gvdn3zq5mzzvrhwdysdq9dp8v3xf9x-source"}]`,
+			expected: []BuildResult{
+				{
+					Outputs: map[string]string{
+						"out": "/nix/store/b5gvdn3zq5mzzvrhwdysdq9dp8v3xf9x-source",
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := getBuildResults([]byte(test.stdout))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package nixcmd
+
+import (
+	"maps"
+	"slices"
+)
+
+// ClosureGraph is the reference graph of store paths, used to find closures without calling Nix for each root.
+type ClosureGraph map[string][]string
+
+// NewClosureGraph creates a graph from the output of nix path-info.
+func NewClosureGraph(entries []PathInfoEntry) ClosureGraph {
+	g := make(ClosureGraph, len(entries))
+	for _, e := range entries {
+		g[e.Path] = e.References
+	}
+	return g
+}
+
+// Paths returns all of the paths in the graph.
+func (g ClosureGraph) Paths() []string {
+	return slices.Sorted(maps.Keys(g))
+}
+
+// Closure returns the roots, and all of the paths they refer to, directly or indirectly.
+func (g ClosureGraph) Closure(roots ...string) (closure []string) {
+	seen := make(map[string]struct{})
+	stack := slices.Clone(roots)
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		stack = append(stack, g[p]...)
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// Subgraph returns the graph of the closure of the roots. References to paths that are not in the graph are kept.
+func (g ClosureGraph) Subgraph(roots ...string) ClosureGraph {
+	sub := make(ClosureGraph)
+	for _, p := range g.Closure(roots...) {
+		if refs, ok := g[p]; ok {
+			sub[p] = refs
+		}
+	}
+	return sub
+}
+
+// Sorted returns all of the paths in the graph, with each path after the paths it refers to, so that copying them in
+// order never copies a path before its references.
+func (g ClosureGraph) Sorted() (sorted []string) {
+	seen := make(map[string]struct{}, len(g))
+	var visit func(p string)
+	visit = func(p string) {
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		refs := slices.Clone(g[p])
+		slices.Sort(refs)
+		for _, ref := range refs {
+			if _, ok := g[ref]; ok {
+				visit(ref)
+			}
+		}
+		sorted = append(sorted, p)
+	}
+	for _, p := range g.Paths() {
+		visit(p)
+	}
+	return sorted
+}
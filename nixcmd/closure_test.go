@@ -0,0 +1,91 @@
+package nixcmd
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClosureGraph(t *testing.T) {
+	g := NewClosureGraph([]PathInfoEntry{
+		{Path: "/nix/store/a-app.drv", References: []string{"/nix/store/b-stdenv.drv", "/nix/store/c-source"}},
+		{Path: "/nix/store/b-stdenv.drv", References: []string{"/nix/store/d-bash.drv"}},
+		{Path: "/nix/store/c-source"},
+		{Path: "/nix/store/d-bash.drv", References: []string{"/nix/store/d-bash.drv"}},
+		{Path: "/nix/store/e-shell.drv", References: []string{"/nix/store/b-stdenv.drv"}},
+	})
+	tests := []struct {
+		name     string
+		roots    []string
+		expected []string
+	}{
+		{
+			name:  "single root",
+			roots: []string{"/nix/store/e-shell.drv"},
+			expected: []string{
+				"/nix/store/b-stdenv.drv",
+				"/nix/store/d-bash.drv",
+				"/nix/store/e-shell.drv",
+			},
+		},
+		{
+			name:  "shared paths are only included once",
+			roots: []string{"/nix/store/a-app.drv", "/nix/store/e-shell.drv"},
+			expected: []string{
+				"/nix/store/a-app.drv",
+				"/nix/store/b-stdenv.drv",
+				"/nix/store/c-source",
+				"/nix/store/d-bash.drv",
+				"/nix/store/e-shell.drv",
+			},
+		},
+		{
+			name:     "leaf",
+			roots:    []string{"/nix/store/c-source"},
+			expected: []string{"/nix/store/c-source"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if diff := cmp.Diff(test.expected, g.Closure(test.roots...)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestClosureGraphSorted(t *testing.T) {
+	g := NewClosureGraph([]PathInfoEntry{
+		{Path: "/nix/store/a-app", References: []string{"/nix/store/c-glibc", "/nix/store/b-openssl", "/nix/store/a-app"}},
+		{Path: "/nix/store/b-openssl", References: []string{"/nix/store/c-glibc"}},
+		{Path: "/nix/store/c-glibc"},
+		{Path: "/nix/store/d-tool", References: []string{"/nix/store/z-not-in-graph"}},
+	})
+	expected := []string{
+		"/nix/store/c-glibc",
+		"/nix/store/b-openssl",
+		"/nix/store/a-app",
+		"/nix/store/d-tool",
+	}
+	if diff := cmp.Diff(expected, g.Sorted()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestClosureGraphSubgraph(t *testing.T) {
+	g := NewClosureGraph([]PathInfoEntry{
+		{Path: "/nix/store/a-app", References: []string{"/nix/store/b-openssl", "/nix/store/z-base"}},
+		{Path: "/nix/store/b-openssl", References: []string{"/nix/store/c-glibc"}},
+		{Path: "/nix/store/c-glibc"},
+		{Path: "/nix/store/d-tool", References: []string{"/nix/store/c-glibc"}},
+	})
+	expected := ClosureGraph{
+		"/nix/store/a-app":     {"/nix/store/b-openssl", "/nix/store/z-base"},
+		"/nix/store/b-openssl": {"/nix/store/c-glibc"},
+		"/nix/store/c-glibc":   nil,
+	}
+	if diff := cmp.Diff(expected, g.Subgraph("/nix/store/a-app")); diff != "" {
+		t.Error(diff)
+	}
+}
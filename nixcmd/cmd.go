@@ -2,6 +2,10 @@ package nixcmd
 
 import "os"
 
+// argBatchSize is the maximum number of store paths passed to a single Nix command, to avoid exceeding
+// the maximum command line length.
+const argBatchSize = 1000
+
 func getEnv() (env []string) {
 	// HOME is required for git to find the user's global gitconfig.
 	if os.Getenv("HOME") == "" {
@@ -1,9 +1,14 @@
 package nixcmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
+	"slices"
+	"strings"
 )
 
 // CopyFrom copies all the paths from the sourceStore to the local nix store. The sourceStore is usually file:///nix-export/nix-store/.
@@ -19,6 +24,10 @@ func CopyFromAll(stdout, stderr io.Writer, codeDir, sourceStore string) (err err
 	return nil
 }
 
+// ErrPathNotValid is returned when `nix copy --all` fails with a "path is not valid" error, which is caused by a bug
+// in Nix, see https://github.com/NixOS/nix/issues/9052. Copying the paths one at a time with CopyFromEach works around it.
+var ErrPathNotValid = errors.New("nix copy failed because a path is not valid")
+
 // CopyFrom copies all the paths from the sourceStore to the local nix store. The sourceStore is usually file:///nix-export/nix-store/.
 func CopyFrom(stdout, stderr io.Writer, codeDir, sourceStore string, derivation bool) (err error) {
 	nixPath, err := exec.LookPath("nix")
@@ -35,45 +44,175 @@ func CopyFrom(stdout, stderr io.Writer, codeDir, sourceStore string, derivation
 	cmd.Dir = codeDir
 
 	w, closer := ErrorBuffer(stdout, stderr)
-	cmd.Stderr = w
+	output := new(bytes.Buffer)
+	cmd.Stderr = io.MultiWriter(w, output)
 	cmd.Stdout = w
-	return closer(cmd.Run())
+	if err = closer(cmd.Run()); err != nil && strings.Contains(output.String(), "is not valid") {
+		return fmt.Errorf("%w: %w", ErrPathNotValid, err)
+	}
+	return err
 }
 
-// CopyToAll copies the paths from the local nix store to the targetStore.
-// It copies both the derivations and the paths.
-// Then copies the realised derivations.
-func CopyToAll(stdout, stderr io.Writer, codeDir, targetStore, ref string) (realisedPathCount int, err error) {
-	if err := CopyTo(stdout, stderr, codeDir, targetStore, true, ref); err != nil {
-		return realisedPathCount, fmt.Errorf("failed to copy derivation: %w", err)
+// CopyFromEach copies the paths in the graph that are not already in the local nix store from the sourceStore, one
+// at a time, with each path copied after the paths it refers to. It's slower than CopyFromAll, but isn't affected by
+// https://github.com/NixOS/nix/issues/9052.
+//
+//	nix copy --no-check-sigs --from <sourceStore> <path>
+//
+// It returns the paths that were retried, and the errors of the paths that could not be copied.
+func CopyFromEach(stdout, stderr io.Writer, codeDir, sourceStore string, graph ClosureGraph) (retried []string, failed map[string]error, err error) {
+	// nix-store --check-validity --print-invalid <paths>
+	invalidPaths, err := NixStoreInvalidPaths(stdout, stderr, graph.Paths())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find paths that are missing from the store: %w", err)
 	}
-	if err := CopyTo(stdout, stderr, codeDir, targetStore, false, ref); err != nil {
-		return realisedPathCount, fmt.Errorf("failed to copy path: %w", err)
+	missing := make(map[string]struct{}, len(invalidPaths))
+	for _, p := range invalidPaths {
+		missing[p] = struct{}{}
 	}
-	// Recursively fetch derivations.
-	drvs, err := PathInfo(stdout, stderr, codeDir, true, true, ref)
+
+	failed = make(map[string]error)
+	for _, p := range graph.Sorted() {
+		if _, ok := missing[p]; !ok {
+			continue
+		}
+		retried = append(retried, p)
+		if err := CopyPathsFrom(stdout, stderr, codeDir, sourceStore, p); err != nil {
+			failed[p] = err
+		}
+	}
+	return retried, failed, nil
+}
+
+// CopyPathsFrom copies the paths, and their closures, from the sourceStore to the local nix store. Derivations are
+// copied as store paths, rather than building their outputs.
+//
+//	nix copy --no-check-sigs --from <sourceStore> <paths>
+func CopyPathsFrom(stdout, stderr io.Writer, codeDir, sourceStore string, paths ...string) (err error) {
+	nixPath, err := exec.LookPath("nix")
 	if err != nil {
-		return realisedPathCount, fmt.Errorf("failed to get path info: %w", err)
+		return fmt.Errorf("failed to find nix on path: %v", err)
 	}
-	if len(drvs) == 0 {
-		return realisedPathCount, nil
+
+	for batch := range slices.Chunk(paths, argBatchSize) {
+		args := append([]string{"copy", "--no-check-sigs", "--from", sourceStore}, batch...)
+		cmd := exec.Command(nixPath, args...)
+		cmd.Dir = codeDir
+		w, closer := ErrorBuffer(stdout, stderr)
+		output := new(bytes.Buffer)
+		cmd.Stderr = io.MultiWriter(w, output)
+		cmd.Stdout = w
+		if err = closer(cmd.Run()); err != nil {
+			if strings.Contains(output.String(), "is not valid") {
+				return fmt.Errorf("%w: %w", ErrPathNotValid, err)
+			}
+			return err
+		}
 	}
-	// nix-store --realise $paths_from_previous_command
-	realisedPaths, err := NixStoreRealise(stdout, stderr, targetStore, drvs)
+	return nil
+}
+
+// CopyClosuresTo copies the build closures of the roots from the local nix store to the targetStore.
+// The roots map a name, e.g. an output attribute path, to store paths, usually the derivations of an installable.
+//
+// The union of the closures of all of the roots is queried, realised, and copied once, so that paths shared between
+// roots, such as stdenv, are only processed once.
+//
+//	nix copy --to file://$PWD/nix-export/nix-store `nix-store --realise $(nix path-info --recursive <roots>)`
+//
+// It returns the store paths in the closure of each root, including the realised outputs of the derivations in the closure.
+func CopyClosuresTo(ctx context.Context, stdout, stderr io.Writer, codeDir, targetStore string, roots map[string][]string) (closures map[string][]string, err error) {
+	return copyClosuresTo(ctx, stdout, stderr, codeDir, targetStore, roots, func(Derivation) bool { return true })
+}
+
+// CopySourcesTo copies the derivation closures of the roots from the local nix store to the targetStore, along with
+// the outputs of the fixed-output derivations in the closures, such as source tarballs and git checkouts. No other
+// outputs are copied, so the target store has to build everything else from source.
+// The roots map a name, e.g. an output attribute path, to derivation store paths.
+//
+//	nix copy --to file://$PWD/nix-export/nix-store $(nix path-info --recursive <drvs>) `nix-store --realise <fixed-output drvs>`
+//
+// It returns the store paths in the closure of each root, including the outputs of the fixed-output derivations.
+func CopySourcesTo(ctx context.Context, stdout, stderr io.Writer, codeDir, targetStore string, roots map[string][]string) (closures map[string][]string, err error) {
+	return copyClosuresTo(ctx, stdout, stderr, codeDir, targetStore, roots, Derivation.IsFixedOutput)
+}
+
+// copyClosuresTo copies the union of the closures of the roots from the local nix store to the targetStore, along
+// with the outputs of the derivations in the closures that are selected by realise, which are built if required.
+//
+// It returns the store paths in the closure of each root, including the selected outputs.
+func copyClosuresTo(ctx context.Context, stdout, stderr io.Writer, codeDir, targetStore string, roots map[string][]string, realise func(drv Derivation) bool) (closures map[string][]string, err error) {
+	var allRoots []string
+	for _, paths := range roots {
+		allRoots = append(allRoots, paths...)
+	}
+	slices.Sort(allRoots)
+	allRoots = slices.Compact(allRoots)
+	if len(allRoots) == 0 {
+		return map[string][]string{}, nil
+	}
+
+	// nix path-info --recursive <roots>
+	entries, err := PathInfoEntries(ctx, stdout, stderr, codeDir, PathInfoOptions{Recursive: true}, allRoots...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get path info: %w", err)
+	}
+	graph := NewClosureGraph(entries)
+	union := graph.Paths()
+
+	// Find the outputs of each derivation in the closure.
+	var drvPaths []string
+	for _, p := range union {
+		if strings.HasSuffix(p, ".drv") {
+			drvPaths = append(drvPaths, p)
+		}
+	}
+	drvs, err := DerivationShow(ctx, stdout, stderr, codeDir, drvPaths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get derivation outputs: %w", err)
+	}
+	var realiseDrvs []string
+	for _, p := range drvPaths {
+		if realise(drvs[p]) {
+			realiseDrvs = append(realiseDrvs, p)
+		}
+	}
+
+	// nix-store --realise <drvs>
+	realisedPaths, err := NixStoreRealise(ctx, stdout, stderr, targetStore, realiseDrvs)
 	if err != nil {
-		return realisedPathCount, fmt.Errorf("failed to realise derivations: %w", err)
+		return nil, fmt.Errorf("failed to realise derivations: %w", err)
 	}
-	if len(realisedPaths) == 0 {
-		return realisedPathCount, nil
+
+	// nix copy --to <targetStore> <union> <realisedPaths>
+	allPaths := slices.Concat(union, realisedPaths)
+	slices.Sort(allPaths)
+	allPaths = slices.Compact(allPaths)
+	for batch := range slices.Chunk(allPaths, argBatchSize) {
+		if err = CopyTo(ctx, stdout, stderr, codeDir, targetStore, false, batch...); err != nil {
+			return nil, fmt.Errorf("failed to copy paths: %w", err)
+		}
 	}
-	// Copy the realised paths.
-	if err = CopyTo(stdout, stderr, codeDir, targetStore, false, realisedPaths...); err != nil {
-		return realisedPathCount, fmt.Errorf("failed to copy realised paths: %w", err)
+
+	closures = make(map[string][]string, len(roots))
+	for name, paths := range roots {
+		var closure []string
+		for _, p := range graph.Closure(paths...) {
+			closure = append(closure, p)
+			if drv, ok := drvs[p]; ok && realise(drv) {
+				closure = append(closure, drv.OutputPaths()...)
+			}
+		}
+		slices.Sort(closure)
+		closures[name] = slices.Compact(closure)
 	}
-	return len(realisedPaths), nil
+	return closures, nil
 }
 
-func CopyTo(stdout, stderr io.Writer, codeDir, targetStore string, derivation bool, paths ...string) (err error) {
+// CopyTo copies the paths, or their derivations, from the local nix store to the targetStore.
+//
+// Nix writes each file to a file:// binary cache store atomically, so it's safe to call concurrently with the same targetStore.
+func CopyTo(ctx context.Context, stdout, stderr io.Writer, codeDir, targetStore string, derivation bool, paths ...string) (err error) {
 	nixPath, err := exec.LookPath("nix")
 	if err != nil {
 		return fmt.Errorf("failed to find nix on path: %v", err)
@@ -84,7 +223,7 @@ func CopyTo(stdout, stderr io.Writer, codeDir, targetStore string, derivation bo
 		args = append(args, "--derivation")
 	}
 	args = append(args, paths...)
-	cmd := exec.Command(nixPath, args...)
+	cmd := exec.CommandContext(ctx, nixPath, args...)
 	cmd.Dir = codeDir
 
 	w, closer := ErrorBuffer(stdout, stderr)
@@ -0,0 +1,116 @@
+package nixcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Derivation is a derivation returned by `nix derivation show`.
+type Derivation struct {
+	// Outputs of the derivation, keyed by output name, e.g. out, dev.
+	Outputs map[string]DerivationOutput `json:"outputs"`
+}
+
+// DerivationOutput is an output of a derivation.
+type DerivationOutput struct {
+	// Path is the store path of the output. It's empty for content-addressed derivations.
+	Path string `json:"path"`
+	// Hash is set for fixed-output derivations, such as source tarballs.
+	Hash string `json:"hash"`
+	// HashAlgo is set for fixed-output derivations.
+	HashAlgo string `json:"hashAlgo"`
+}
+
+// IsFixedOutput returns true if the derivation is a fixed-output derivation, such as a fetchurl or fetchgit call.
+func (d Derivation) IsFixedOutput() bool {
+	for _, o := range d.Outputs {
+		if o.Hash != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputPaths returns the store paths of the outputs of the derivation.
+func (d Derivation) OutputPaths() (paths []string) {
+	for _, o := range d.Outputs {
+		if o.Path != "" {
+			paths = append(paths, o.Path)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// DerivationShow returns the derivations of the store paths, keyed by derivation store path.
+//
+//	nix derivation show <drvPaths>
+func DerivationShow(ctx context.Context, stdout, stderr io.Writer, codeDir string, drvPaths ...string) (drvs map[string]Derivation, err error) {
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		return drvs, fmt.Errorf("failed to find nix on path: %w", err)
+	}
+
+	drvs = make(map[string]Derivation, len(drvPaths))
+	for batch := range slices.Chunk(drvPaths, argBatchSize) {
+		stdoutBuffer := new(bytes.Buffer)
+		cmd := exec.CommandContext(ctx, nixPath, append([]string{"derivation", "show"}, batch...)...)
+		cmd.Env = getEnv()
+		cmd.Dir = codeDir
+
+		w, closer := ErrorBuffer(stdout, stderr)
+		cmd.Stdout = stdoutBuffer
+		cmd.Stderr = w
+		if err = closer(cmd.Run()); err != nil {
+			return drvs, fmt.Errorf("failed to run nix derivation show: %w", err)
+		}
+		batchDrvs, err := getDerivations(stdoutBuffer.Bytes(), path.Dir(batch[0]))
+		if err != nil {
+			return drvs, err
+		}
+		for k, v := range batchDrvs {
+			drvs[k] = v
+		}
+	}
+	return drvs, nil
+}
+
+func getDerivations(stdout []byte, storeDir string) (drvs map[string]Derivation, err error) {
+	var op map[string]json.RawMessage
+	if err = json.Unmarshal(stdout, &op); err != nil {
+		return drvs, fmt.Errorf("failed to parse nix derivation show output: %w", err)
+	}
+	// Newer versions of Nix nest the derivations within a "derivations" key.
+	if nested, ok := op["derivations"]; ok {
+		op = nil
+		if err = json.Unmarshal(nested, &op); err != nil {
+			return drvs, fmt.Errorf("failed to parse nix derivation show output: %w", err)
+		}
+	}
+	drvs = make(map[string]Derivation, len(op))
+	for k, v := range op {
+		var drv Derivation
+		if err = json.Unmarshal(v, &drv); err != nil {
+			return drvs, fmt.Errorf("failed to parse derivation %q: %w", k, err)
+		}
+		// Some Nix versions output base names, rather than full store paths.
+		if !strings.HasPrefix(k, "/") {
+			k = path.Join(storeDir, k)
+		}
+		for name, o := range drv.Outputs {
+			if o.Path != "" && !strings.HasPrefix(o.Path, "/") {
+				o.Path = path.Join(storeDir, o.Path)
+				drv.Outputs[name] = o
+			}
+		}
+		drvs[k] = drv
+	}
+	return drvs, nil
+}
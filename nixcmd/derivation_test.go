@@ -0,0 +1,100 @@
+package nixcmd
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDerivations(t *testing.T) {
+	tests := []struct {
+		name     string
+		stdout   string
+		expected map[string]Derivation
+	}{
+		{
+			name: "full store paths",
+			stdout: `{
+  "/nix/store/8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv": {
+    "name": "app-0.0.1",
+    "outputs": {
+      "out": {
+        "path": "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1"
+      }
+    }
+  },
+  "/nix/store/0qx9zccdrgvp1nfh7iq3b0mxqvq3ha3j-source.tar.gz.drv": {
+    "name": "source.tar.gz",
+    "outputs": {
+      "out": {
+        "hash": "1b1e5c7ba9e6a1a3a4a2c7d9a1c8e3f0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4",
+        "hashAlgo": "sha256",
+        "path": "/nix/store/kgzvi0y6b9k0vfq9xmpr1vdl5f5nfgs9-source.tar.gz"
+      }
+    }
+  }
+}`,
+			expected: map[string]Derivation{
+				"/nix/store/8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv": {
+					Outputs: map[string]DerivationOutput{
+						"out": {Path: "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1"},
+					},
+				},
+				"/nix/store/0qx9zccdrgvp1nfh7iq3b0mxqvq3ha3j-source.tar.gz.drv": {
+					Outputs: map[string]DerivationOutput{
+						"out": {
+							Path:     "/nix/store/kgzvi0y6b9k0vfq9xmpr1vdl5f5nfgs9-source.tar.gz",
+							Hash:     "1b1e5c7ba9e6a1a3a4a2c7d9a1c8e3f0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4",
+							HashAlgo: "sha256",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "nested base names",
+			stdout: `{
+  "derivations": {
+    "8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv": {
+      "outputs": {
+        "out": {
+          "path": "6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1"
+        }
+      }
+    }
+  },
+  "version": 4
+}`,
+			expected: map[string]Derivation{
+				"/nix/store/8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv": {
+					Outputs: map[string]DerivationOutput{
+						"out": {Path: "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1"},
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := getDerivations([]byte(test.stdout), "/nix/store")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDerivationIsFixedOutput(t *testing.T) {
+	fod := Derivation{Outputs: map[string]DerivationOutput{"out": {Path: "/nix/store/a-source", Hash: "abc", HashAlgo: "sha256"}}}
+	if !fod.IsFixedOutput() {
+		t.Error("expected fixed-output derivation")
+	}
+	drv := Derivation{Outputs: map[string]DerivationOutput{"out": {Path: "/nix/store/a-app"}}}
+	if drv.IsFixedOutput() {
+		t.Error("expected input-addressed derivation")
+	}
+}
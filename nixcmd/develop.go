@@ -5,29 +5,32 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path/filepath"
 )
 
-// Develop runs the development shell.
-// In the case of:
+// DevelopProfile realises the development environment of the ref and saves it to the profile, so that it can be
+// entered with `nix develop <profile>` without the build closure of the devShell.
+// It returns the store path of the environment.
 //
-//	nix develop --command python --version
-//
-// The following command will be executed within the development shell:
-//
-//	python --version
-func Develop(ctx context.Context, stdout, stderr io.Writer, codeDir string, args ...string) (err error) {
+//	nix develop --profile <profile> <ref> --command true
+func DevelopProfile(ctx context.Context, stdout, stderr io.Writer, codeDir, profile, ref string) (envPath string, err error) {
 	nixPath, err := exec.LookPath("nix")
 	if err != nil {
-		return fmt.Errorf("failed to find nix on path: %v", err)
+		return envPath, fmt.Errorf("failed to find nix on path: %v", err)
 	}
 
-	// Execute.
-	cmd := exec.Command(nixPath, append([]string{"develop", "--command"}, args...)...)
+	cmd := exec.CommandContext(ctx, nixPath, "develop", "--profile", profile, ref, "--command", "true")
 	cmd.Env = getEnv()
 	cmd.Dir = codeDir
 
 	w, closer := ErrorBuffer(stdout, stderr)
 	cmd.Stderr = w
 	cmd.Stdout = w
-	return closer(cmd.Run())
+	if err = closer(cmd.Run()); err != nil {
+		return envPath, err
+	}
+	if envPath, err = filepath.EvalSymlinks(profile); err != nil {
+		return envPath, fmt.Errorf("failed to read profile %q: %w", profile, err)
+	}
+	return envPath, nil
 }
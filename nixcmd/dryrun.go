@@ -0,0 +1,86 @@
+package nixcmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// DryRunResult is what `nix build --dry-run` reports that building the refs would do.
+type DryRunResult struct {
+	// Build are the derivations that would be built.
+	Build []string
+	// Fetch are the store paths that would be downloaded from a substituter.
+	Fetch []string
+	// FetchSizes are the download and unpacked sizes of the paths to fetch reported by Nix, e.g.
+	// "12.50 MiB download, 60.31 MiB unpacked", one for each batch of refs.
+	FetchSizes []string
+}
+
+// BuildDryRun reports which derivations would be built, and which store paths would be fetched, to build the refs,
+// without building or fetching anything. Paths needed by more than one batch of refs are reported once per batch.
+//
+//	nix build --dry-run --no-link <refs>
+func BuildDryRun(ctx context.Context, stdout, stderr io.Writer, codeDir string, refs ...string) (result DryRunResult, err error) {
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		return result, fmt.Errorf("failed to find nix on path: %v", err)
+	}
+
+	for batch := range slices.Chunk(refs, argBatchSize) {
+		// Nix writes what it would do to stderr.
+		stderrBuffer := new(bytes.Buffer)
+		args := append([]string{"build", "--dry-run", "--no-link"}, batch...)
+		cmd := exec.CommandContext(ctx, nixPath, args...)
+		cmd.Env = getEnv()
+		cmd.Dir = codeDir
+		cmd.Stdout = stdout
+		cmd.Stderr = stderrBuffer
+		if err = cmd.Run(); err != nil {
+			stderr.Write(stderrBuffer.Bytes()) //nolint
+			return result, fmt.Errorf("failed to run nix build --dry-run: %w", err)
+		}
+		batchResult := parseDryRun(stderrBuffer)
+		result.Build = append(result.Build, batchResult.Build...)
+		result.Fetch = append(result.Fetch, batchResult.Fetch...)
+		result.FetchSizes = append(result.FetchSizes, batchResult.FetchSizes...)
+	}
+	return result, nil
+}
+
+// parseDryRun parses the output of `nix build --dry-run`, e.g.:
+//
+//	these 2 derivations will be built:
+//	  /nix/store/<hash>-hello-2.12.1.drv
+//	  /nix/store/<hash>-app.drv
+//	this path will be fetched (0.05 MiB download, 0.22 MiB unpacked):
+//	  /nix/store/<hash>-bash-5.2p37
+func parseDryRun(r io.Reader) (result DryRunResult) {
+	var section *[]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "  ") {
+			if p := strings.TrimSpace(line); section != nil && strings.HasPrefix(p, "/") {
+				*section = append(*section, p)
+			}
+			continue
+		}
+		section = nil
+		switch {
+		case strings.Contains(line, " will be built:"):
+			section = &result.Build
+		case strings.Contains(line, " will be fetched"):
+			section = &result.Fetch
+			if start, end := strings.Index(line, "("), strings.LastIndex(line, ")"); start >= 0 && end > start {
+				result.FetchSizes = append(result.FetchSizes, line[start+1:end])
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package nixcmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDryRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected DryRunResult
+	}{
+		{
+			name:     "nothing to do",
+			input:    "",
+			expected: DryRunResult{},
+		},
+		{
+			name: "derivations to build and paths to fetch",
+			input: `these 2 derivations will be built:
+  /nix/store/abc-hello-2.12.1.drv
+  /nix/store/def-app.drv
+these 3 paths will be fetched (1.50 MiB download, 7.25 MiB unpacked):
+  /nix/store/ghi-bash-5.2p37
+  /nix/store/jkl-glibc-2.40-66
+  /nix/store/mno-hello-2.12.1.tar.gz
+`,
+			expected: DryRunResult{
+				Build:      []string{"/nix/store/abc-hello-2.12.1.drv", "/nix/store/def-app.drv"},
+				Fetch:      []string{"/nix/store/ghi-bash-5.2p37", "/nix/store/jkl-glibc-2.40-66", "/nix/store/mno-hello-2.12.1.tar.gz"},
+				FetchSizes: []string{"1.50 MiB download, 7.25 MiB unpacked"},
+			},
+		},
+		{
+			name: "single derivation, and warnings are ignored",
+			input: `warning: Git tree '/code' is dirty
+this derivation will be built:
+  /nix/store/abc-hello-2.12.1.drv
+`,
+			expected: DryRunResult{
+				Build: []string{"/nix/store/abc-hello-2.12.1.drv"},
+			},
+		},
+		{
+			name: "single path to fetch",
+			input: `this path will be fetched (0.05 MiB download, 0.22 MiB unpacked):
+  /nix/store/ghi-bash-5.2p37
+`,
+			expected: DryRunResult{
+				Fetch:      []string{"/nix/store/ghi-bash-5.2p37"},
+				FetchSizes: []string{"0.05 MiB download, 0.22 MiB unpacked"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := parseDryRun(strings.NewReader(tt.input))
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package nixcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// EvalJSON evaluates the installable found in codeDir, applies the Nix function in apply, and decodes the JSON result into v.
+//
+//	nix eval --json .#nixosConfigurations --apply 'builtins.attrNames'
+func EvalJSON[T any](stdout, stderr io.Writer, codeDir, installable, apply string) (v T, err error) {
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		return v, fmt.Errorf("failed to find nix on path: %w", err)
+	}
+
+	args := []string{"eval", "--json", installable}
+	if apply != "" {
+		args = append(args, "--apply", apply)
+	}
+
+	stdoutBuffer := new(bytes.Buffer)
+	cmd := exec.Command(nixPath, args...)
+	cmd.Env = getEnv()
+	cmd.Dir = codeDir
+
+	w, closer := ErrorBuffer(stdout, stderr)
+	cmd.Stdout = stdoutBuffer
+	cmd.Stderr = w
+	if err = closer(cmd.Run()); err != nil {
+		return v, fmt.Errorf("failed to run nix eval %s: %w", installable, err)
+	}
+
+	if err = json.Unmarshal(stdoutBuffer.Bytes(), &v); err != nil {
+		return v, fmt.Errorf("failed to parse nix eval output: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,71 @@
+package nixcmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// OutputFilter selects flake outputs by attribute path using glob patterns, e.g. "packages.*.default".
+//
+// Each pattern is matched against the attribute path one segment at a time, so "*" matches a single
+// attribute name, and never crosses a ".".
+type OutputFilter struct {
+	// Include patterns. If empty, all outputs are included.
+	Include []string
+	// Exclude patterns. Outputs that match an exclude pattern are never included.
+	Exclude []string
+}
+
+// NewOutputFilter creates a filter from include and exclude patterns.
+// Include patterns that start with "!" are treated as exclude patterns, e.g. "!packages.*.*-docker-image".
+func NewOutputFilter(include, exclude []string) (f OutputFilter, err error) {
+	for _, p := range include {
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			f.Exclude = append(f.Exclude, negated)
+			continue
+		}
+		f.Include = append(f.Include, p)
+	}
+	f.Exclude = append(f.Exclude, exclude...)
+	for _, p := range append(f.Include, f.Exclude...) {
+		if _, err := path.Match(attributePathToGlob(p), ""); err != nil {
+			return f, fmt.Errorf("invalid output pattern %q: %w", p, err)
+		}
+	}
+	return f, nil
+}
+
+// Match returns true if the ref, e.g. ".#packages.x86_64-linux.default" is selected by the filter.
+func (f OutputFilter) Match(ref string) bool {
+	attr := attributePathToGlob(strings.TrimPrefix(ref, ".#"))
+	if len(f.Include) > 0 && !matchAny(f.Include, attr) {
+		return false
+	}
+	return !matchAny(f.Exclude, attr)
+}
+
+// Filter returns the refs that are selected by the filter.
+func (f OutputFilter) Filter(refs []string) (matches []string) {
+	for _, ref := range refs {
+		if f.Match(ref) {
+			matches = append(matches, ref)
+		}
+	}
+	return matches
+}
+
+func matchAny(patterns []string, attr string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(attributePathToGlob(p), attr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// attributePathToGlob converts the "." separators of an attribute path to "/" so that path.Match
+// treats each attribute name as a path segment.
+func attributePathToGlob(attr string) string {
+	return strings.ReplaceAll(attr, ".", "/")
+}
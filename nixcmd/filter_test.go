@@ -0,0 +1,85 @@
+package nixcmd
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutputFilter(t *testing.T) {
+	refs := []string{
+		".#devShells.x86_64-linux.default",
+		".#packages.x86_64-linux.app-docker-image",
+		".#packages.x86_64-linux.default",
+		".#packages.x86_64-linux.python",
+	}
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:     "no patterns include everything",
+			expected: refs,
+		},
+		{
+			name:    "include",
+			include: []string{"packages.*.default"},
+			expected: []string{
+				".#packages.x86_64-linux.default",
+			},
+		},
+		{
+			name:    "exclude",
+			exclude: []string{"packages.*.*-docker-image"},
+			expected: []string{
+				".#devShells.x86_64-linux.default",
+				".#packages.x86_64-linux.default",
+				".#packages.x86_64-linux.python",
+			},
+		},
+		{
+			name:    "negated include patterns are excludes",
+			include: []string{"packages.*.*", "!packages.*.*-docker-image"},
+			expected: []string{
+				".#packages.x86_64-linux.default",
+				".#packages.x86_64-linux.python",
+			},
+		},
+		{
+			name:     "wildcards do not cross attribute names",
+			include:  []string{"packages.*"},
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			f, err := NewOutputFilter(test.include, test.exclude)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, f.Filter(refs)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestOutputFilterInvalidPattern(t *testing.T) {
+	if _, err := NewOutputFilter([]string{"packages.[.default"}, nil); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestOutputFilterDoesNotModifyExclude(t *testing.T) {
+	exclude := make([]string, 1, 2)
+	exclude[0] = "packages.*.python"
+	if _, err := NewOutputFilter([]string{"!packages.*.*-docker-image"}, exclude); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if extra := exclude[:cap(exclude)][1]; extra != "" {
+		t.Errorf("expected the exclude slice's backing array to be unchanged, got %q", extra)
+	}
+}
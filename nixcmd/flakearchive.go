@@ -1,24 +1,57 @@
 package nixcmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
+	"slices"
 )
 
-func FlakeArchive(stdout, stderr io.Writer, codeDir, targetStore string) (err error) {
+// FlakeArchive copies the flake source and the sources of all of its inputs to the targetStore.
+// It returns the store paths of the sources that were copied.
+func FlakeArchive(stdout, stderr io.Writer, codeDir, targetStore string) (paths []string, err error) {
 	nixPath, err := exec.LookPath("nix")
 	if err != nil {
-		return fmt.Errorf("failed to find nix on path: %v", err)
+		return paths, fmt.Errorf("failed to find nix on path: %v", err)
 	}
 
 	// Inside the Docker container, the export is hard coded to /nix-export/nix-store/
 	// So, the targetStore would be file:///nix-export/nix-store/
-	cmd := exec.Command(nixPath, "flake", "archive", "--to", targetStore)
+	stdoutBuffer := new(bytes.Buffer)
+	cmd := exec.Command(nixPath, "flake", "archive", "--json", "--to", targetStore)
 	cmd.Dir = codeDir
 
 	w, closer := ErrorBuffer(stdout, stderr)
 	cmd.Stderr = w
-	cmd.Stdout = w
-	return closer(cmd.Run())
+	cmd.Stdout = io.MultiWriter(stdoutBuffer, w)
+	if err = closer(cmd.Run()); err != nil {
+		return paths, err
+	}
+	return getFlakeArchivePaths(stdoutBuffer.Bytes())
+}
+
+type flakeArchiveOutput struct {
+	Path   string                        `json:"path"`
+	Inputs map[string]flakeArchiveOutput `json:"inputs"`
+}
+
+func getFlakeArchivePaths(stdout []byte) (paths []string, err error) {
+	var op flakeArchiveOutput
+	if err = json.Unmarshal(stdout, &op); err != nil {
+		return paths, fmt.Errorf("failed to parse nix flake archive output: %w", err)
+	}
+	var walk func(op flakeArchiveOutput)
+	walk = func(op flakeArchiveOutput) {
+		if op.Path != "" && !slices.Contains(paths, op.Path) {
+			paths = append(paths, op.Path)
+		}
+		for _, input := range op.Inputs {
+			walk(input)
+		}
+	}
+	walk(op)
+	slices.Sort(paths)
+	return paths, nil
 }
@@ -0,0 +1,40 @@
+package nixcmd
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFlakeArchivePaths(t *testing.T) {
+	stdout := `{
+  "inputs": {
+    "gitignore": {
+      "inputs": {
+        "nixpkgs": {
+          "inputs": {},
+          "path": "/nix/store/6ssvqs0rz7x7ylx1i0x62clr5z2mcycg-source"
+        }
+      },
+      "path": "/nix/store/mz5xdhyqrb8a7imha7shzsn0j5w6g0d7-source"
+    },
+    "nixpkgs": {
+      "inputs": {},
+      "path": "/nix/store/6ssvqs0rz7x7ylx1i0x62clr5z2mcycg-source"
+    }
+  },
+  "path": "/nix/store/b5gvdn3zq5mzzvrhwdysdq9dp8v3xf9x-source"
+}`
+	expected := []string{
+		"/nix/store/6ssvqs0rz7x7ylx1i0x62clr5z2mcycg-source",
+		"/nix/store/b5gvdn3zq5mzzvrhwdysdq9dp8v3xf9x-source",
+		"/nix/store/mz5xdhyqrb8a7imha7shzsn0j5w6g0d7-source",
+	}
+	actual, err := getFlakeArchivePaths([]byte(stdout))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
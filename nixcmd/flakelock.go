@@ -0,0 +1,298 @@
+package nixcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FlakeLock is the content of a flake.lock file.
+type FlakeLock struct {
+	// Nodes of the lock file, keyed by node name.
+	Nodes map[string]FlakeLockNode `json:"nodes"`
+	// Root is the name of the node of the flake itself.
+	Root string `json:"root"`
+	// Version of the lock file format.
+	Version int `json:"version"`
+}
+
+// FlakeLockNode is a locked flake input.
+type FlakeLockNode struct {
+	// Inputs of the node, keyed by input name.
+	Inputs map[string]FlakeLockInput `json:"inputs"`
+	// Locked is the locked reference of the node. It's not set for the root node.
+	Locked *LockedRef `json:"locked"`
+	// Flake is false if the input is not a flake, e.g. a source tarball.
+	Flake *bool `json:"flake"`
+}
+
+// IsFlake returns true if the node is a flake.
+func (n FlakeLockNode) IsFlake() bool {
+	return n.Flake == nil || *n.Flake
+}
+
+// FlakeLockInput is an input of a node. It's either the name of a node, or a path of input names, starting from the
+// root node, for inputs that follow other inputs, e.g. "inputs.nixpkgs.follows = "nix/nixpkgs"".
+type FlakeLockInput struct {
+	// Node is the name of the node the input refers to.
+	Node string
+	// Follows is the input path that the input follows.
+	Follows []string
+}
+
+func (i *FlakeLockInput) UnmarshalJSON(data []byte) (err error) {
+	if err = json.Unmarshal(data, &i.Node); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &i.Follows)
+}
+
+// ReadFlakeLock reads a flake.lock file.
+func ReadFlakeLock(r io.Reader) (l FlakeLock, err error) {
+	if err = json.NewDecoder(r).Decode(&l); err != nil {
+		return l, fmt.Errorf("failed to parse flake.lock: %w", err)
+	}
+	if _, ok := l.Nodes[l.Root]; !ok {
+		return l, fmt.Errorf("root node %q not found in flake.lock", l.Root)
+	}
+	return l, nil
+}
+
+// Resolve returns the name of the node that the input path refers to, following any inputs that follow other inputs.
+// The input path starts at the root node, e.g. ["nix", "nixpkgs"] is the nixpkgs input of the nix input.
+func (l FlakeLock) Resolve(inputPath ...string) (node string, err error) {
+	return l.resolve(inputPath, 0)
+}
+
+// maxFollowsDepth stops circular follows from recursing forever.
+const maxFollowsDepth = 32
+
+func (l FlakeLock) resolve(inputPath []string, depth int) (node string, err error) {
+	if depth > maxFollowsDepth {
+		return node, fmt.Errorf("too many levels of follows resolving input %q", strings.Join(inputPath, "/"))
+	}
+	node = l.Root
+	for i, name := range inputPath {
+		input, ok := l.Nodes[node].Inputs[name]
+		if !ok {
+			return node, fmt.Errorf("input %q not found", strings.Join(inputPath[:i+1], "/"))
+		}
+		if input.Follows == nil {
+			node = input.Node
+			continue
+		}
+		if node, err = l.resolve(input.Follows, depth+1); err != nil {
+			return node, err
+		}
+	}
+	if _, ok := l.Nodes[node]; !ok {
+		return node, fmt.Errorf("node %q of input %q not found", node, strings.Join(inputPath, "/"))
+	}
+	return node, nil
+}
+
+// LockedInput is a node of the lock file, and the shortest input path that refers to it.
+type LockedInput struct {
+	// Path of input names from the root node, e.g. ["nix", "nixpkgs"].
+	Path []string
+	// Node is the name of the node in the lock file.
+	Node string
+}
+
+// Name returns the input path, joined with "/", as used by the follows attribute, e.g. nix/nixpkgs.
+func (i LockedInput) Name() string {
+	return strings.Join(i.Path, "/")
+}
+
+// Inputs returns every node that is reachable from the root node, directly or through other inputs. Each node is
+// returned once, with the shortest input path that refers to it, in order of input path.
+func (l FlakeLock) Inputs() (inputs []LockedInput, err error) {
+	seen := map[string]struct{}{l.Root: {}}
+	queue := [][]string{nil}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		parentNode, err := l.Resolve(parent...)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range slices.Sorted(maps.Keys(l.Nodes[parentNode].Inputs)) {
+			inputPath := append(slices.Clone(parent), name)
+			node, err := l.Resolve(inputPath...)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := seen[node]; ok {
+				continue
+			}
+			seen[node] = struct{}{}
+			inputs = append(inputs, LockedInput{Path: inputPath, Node: node})
+			queue = append(queue, inputPath)
+		}
+	}
+	return inputs, nil
+}
+
+// PathInput is a flake input that refers to a directory relative to the root flake, e.g. "path:../shared".
+type PathInput struct {
+	// Name is the input path, e.g. shared, or shared/utils for the utils input of the shared input.
+	Name string
+	// Path of the input, slash separated and relative to the directory of the root flake, e.g. ../shared.
+	Path string
+}
+
+// PathInputs returns the inputs that are locked to a relative path on disk, rather than to the Nix store or a remote
+// source. Relative inputs of relative inputs are resolved relative to the root flake. Relative inputs of other inputs,
+// such as github inputs, are within the source of that input, so are not returned.
+func (l FlakeLock) PathInputs() (inputs []PathInput, err error) {
+	lockedInputs, err := l.Inputs()
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]string)
+	for _, input := range lockedInputs {
+		locked := l.Nodes[input.Node].Locked
+		if locked == nil || locked.Type != "path" || path.IsAbs(locked.Path) {
+			continue
+		}
+		parentDir := "."
+		if len(input.Path) > 1 {
+			var ok bool
+			if parentDir, ok = dirs[strings.Join(input.Path[:len(input.Path)-1], "/")]; !ok {
+				continue
+			}
+		}
+		p := path.Join(parentDir, locked.Path)
+		dirs[input.Name()] = p
+		inputs = append(inputs, PathInput{Name: input.Name(), Path: p})
+	}
+	return inputs, nil
+}
+
+// Ref returns the flake reference of the locked node, e.g. github:NixOS/nixpkgs/<rev>?narHash=<hash>.
+func (l FlakeLock) Ref(node string) (ref string, err error) {
+	n, ok := l.Nodes[node]
+	if !ok {
+		return ref, fmt.Errorf("node %q not found", node)
+	}
+	if n.Locked == nil {
+		return ref, fmt.Errorf("node %q is not locked", node)
+	}
+	if ref, err = n.Locked.FlakeRef(); err != nil {
+		return ref, fmt.Errorf("node %q: %w", node, err)
+	}
+	return ref, nil
+}
+
+// LockedRef is the locked reference of a flake input.
+type LockedRef struct {
+	// Type of the input, e.g. github, git, tarball, path.
+	Type string `json:"type"`
+	// Owner of the repository, for github, gitlab and sourcehut inputs. Sourcehut owners start with "~".
+	Owner string `json:"owner,omitempty"`
+	// Repo is the name of the repository, for github, gitlab and sourcehut inputs.
+	Repo string `json:"repo,omitempty"`
+	// Host overrides the default host of github, gitlab and sourcehut inputs, e.g. for GitHub Enterprise.
+	Host string `json:"host,omitempty"`
+	// URL of git, hg, tarball and file inputs.
+	URL string `json:"url,omitempty"`
+	// Path of path inputs.
+	Path string `json:"path,omitempty"`
+	// Rev is the commit hash.
+	Rev string `json:"rev,omitempty"`
+	// Ref is the branch or tag, for git and hg inputs.
+	Ref string `json:"ref,omitempty"`
+	// Dir is the subdirectory of the input that contains the flake.
+	Dir string `json:"dir,omitempty"`
+	// Submodules is set if the submodules of a git input are fetched.
+	Submodules bool `json:"submodules,omitempty"`
+	// NarHash is the hash of the NAR serialisation of the input.
+	NarHash string `json:"narHash,omitempty"`
+	// LastModified is the time of the commit, or of the most recently modified file, as a Unix timestamp.
+	LastModified int64 `json:"lastModified,omitempty"`
+	// RevCount is the number of commits in the history of rev.
+	RevCount int64 `json:"revCount,omitempty"`
+}
+
+// FlakeRef returns the flake reference of the locked input, with its narHash, so that Nix verifies the content of the input.
+//
+// Nix doesn't accept lastModified or revCount in github, gitlab and sourcehut references, so they are only included
+// for the input types that accept them.
+func (l LockedRef) FlakeRef() (ref string, err error) {
+	query := url.Values{}
+	setQuery := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	setQueryInt := func(key string, value int64) {
+		if value != 0 {
+			query.Set(key, strconv.FormatInt(value, 10))
+		}
+	}
+	switch l.Type {
+	case "github", "gitlab", "sourcehut":
+		if l.Owner == "" || l.Repo == "" || l.Rev == "" {
+			return ref, fmt.Errorf("%s input requires owner, repo and rev", l.Type)
+		}
+		ref = fmt.Sprintf("%s:%s/%s/%s", l.Type, l.Owner, l.Repo, l.Rev)
+		setQuery("host", l.Host)
+	case "git", "hg":
+		if l.URL == "" || l.Rev == "" {
+			return ref, fmt.Errorf("%s input requires url and rev", l.Type)
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil {
+			return ref, fmt.Errorf("invalid %s url %q: %w", l.Type, l.URL, err)
+		}
+		query = u.Query()
+		u.RawQuery = ""
+		ref = l.Type + "+" + u.String()
+		setQuery("ref", l.Ref)
+		setQuery("rev", l.Rev)
+		setQueryInt("revCount", l.RevCount)
+		if l.Type == "git" {
+			setQueryInt("lastModified", l.LastModified)
+			if l.Submodules {
+				query.Set("submodules", "1")
+			}
+		}
+	case "tarball", "file":
+		if l.URL == "" {
+			return ref, fmt.Errorf("%s input requires url", l.Type)
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil {
+			return ref, fmt.Errorf("invalid %s url %q: %w", l.Type, l.URL, err)
+		}
+		// The query of the URL is kept, e.g. the rev of FlakeHub URLs.
+		query = u.Query()
+		u.RawQuery = ""
+		ref = l.Type + "+" + u.String()
+		setQuery("rev", l.Rev)
+		setQueryInt("revCount", l.RevCount)
+		setQueryInt("lastModified", l.LastModified)
+	case "path":
+		if l.Path == "" {
+			return ref, fmt.Errorf("path input requires path")
+		}
+		ref = "path:" + l.Path
+		setQuery("rev", l.Rev)
+		setQueryInt("revCount", l.RevCount)
+		setQueryInt("lastModified", l.LastModified)
+	default:
+		return ref, fmt.Errorf("unsupported input type %q", l.Type)
+	}
+	setQuery("dir", l.Dir)
+	setQuery("narHash", l.NarHash)
+	if len(query) > 0 {
+		ref += "?" + query.Encode()
+	}
+	return ref, nil
+}
@@ -0,0 +1,771 @@
+package nixcmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const followsLockFile = `{
+  "nodes": {
+    "nix": {
+      "inputs": {
+        "nixpkgs": "nixpkgs",
+        "nixpkgs-regression": "nixpkgs-regression"
+      },
+      "locked": { "owner": "nixos", "repo": "nix", "rev": "597fcc98", "type": "github" }
+    },
+    "nixpkgs": {
+      "locked": { "owner": "NixOS", "repo": "nixpkgs", "rev": "080166c1", "type": "github" }
+    },
+    "nixpkgs-regression": {
+      "locked": { "owner": "NixOS", "repo": "nixpkgs", "rev": "215d4d0f", "type": "github" }
+    },
+    "nixpkgs-unstable": {
+      "locked": { "owner": "NixOS", "repo": "nixpkgs", "rev": "64b80bfb", "type": "github" }
+    },
+    "src": {
+      "flake": false,
+      "locked": { "owner": "a-h", "repo": "src", "rev": "35bb57c0", "type": "github" }
+    },
+    "xc": {
+      "inputs": {
+        "nixpkgs": ["nix", "nixpkgs"]
+      },
+      "locked": { "owner": "joerdav", "repo": "xc", "rev": "6183dd54", "type": "github" }
+    },
+    "root": {
+      "inputs": {
+        "nix": "nix",
+        "nixpkgs": ["nix", "nixpkgs"],
+        "nixpkgs-unstable": "nixpkgs-unstable",
+        "src": "src",
+        "xc": "xc"
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`
+
+func TestFlakeLockResolve(t *testing.T) {
+	l, err := ReadFlakeLock(strings.NewReader(followsLockFile))
+	if err != nil {
+		t.Fatalf("failed to read flake.lock: %v", err)
+	}
+	tests := []struct {
+		name      string
+		inputPath []string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "no input path is the root node",
+			expected: "root",
+		},
+		{
+			name:      "direct input",
+			inputPath: []string{"nixpkgs-unstable"},
+			expected:  "nixpkgs-unstable",
+		},
+		{
+			name:      "nested input",
+			inputPath: []string{"nix", "nixpkgs-regression"},
+			expected:  "nixpkgs-regression",
+		},
+		{
+			name:      "root input follows nested input",
+			inputPath: []string{"nixpkgs"},
+			expected:  "nixpkgs",
+		},
+		{
+			name:      "nested input follows nested input",
+			inputPath: []string{"xc", "nixpkgs"},
+			expected:  "nixpkgs",
+		},
+		{
+			name:      "missing input",
+			inputPath: []string{"xc", "flake-utils"},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := l.Resolve(test.inputPath...)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got node %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFlakeLockInputs(t *testing.T) {
+	l, err := ReadFlakeLock(strings.NewReader(followsLockFile))
+	if err != nil {
+		t.Fatalf("failed to read flake.lock: %v", err)
+	}
+	actual, err := l.Inputs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []LockedInput{
+		{Path: []string{"nix"}, Node: "nix"},
+		{Path: []string{"nixpkgs"}, Node: "nixpkgs"},
+		{Path: []string{"nixpkgs-unstable"}, Node: "nixpkgs-unstable"},
+		{Path: []string{"src"}, Node: "src"},
+		{Path: []string{"xc"}, Node: "xc"},
+		{Path: []string{"nix", "nixpkgs-regression"}, Node: "nixpkgs-regression"},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected inputs (-want +got):\n%s", diff)
+	}
+}
+
+func TestFlakeLockCircularFollows(t *testing.T) {
+	l, err := ReadFlakeLock(strings.NewReader(`{
+  "nodes": {
+    "root": {
+      "inputs": {
+        "a": ["b"],
+        "b": ["a"]
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`))
+	if err != nil {
+		t.Fatalf("failed to read flake.lock: %v", err)
+	}
+	if _, err := l.Resolve("a"); err == nil {
+		t.Error("expected error resolving circular follows")
+	}
+}
+
+func TestLockedRefFlakeRef(t *testing.T) {
+	const narHash = "sha256-9z8oOgFZiaguj+bbi3k4QhAD6JabWrnv7fscC/mt0KE="
+	const encodedNarHash = "sha256-9z8oOgFZiaguj%2Bbbi3k4QhAD6JabWrnv7fscC%2Fmt0KE%3D"
+	tests := []struct {
+		name      string
+		locked    LockedRef
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "github",
+			locked: LockedRef{
+				Type:         "github",
+				Owner:        "NixOS",
+				Repo:         "nixpkgs",
+				Rev:          "64b80bfb",
+				NarHash:      narHash,
+				LastModified: 1730137625,
+			},
+			expected: "github:NixOS/nixpkgs/64b80bfb?narHash=" + encodedNarHash,
+		},
+		{
+			name: "github enterprise with flake in subdirectory",
+			locked: LockedRef{
+				Type:  "github",
+				Owner: "a-h",
+				Repo:  "flakes",
+				Rev:   "64b80bfb",
+				Host:  "github.example.com",
+				Dir:   "nix",
+			},
+			expected: "github:a-h/flakes/64b80bfb?dir=nix&host=github.example.com",
+		},
+		{
+			name: "gitlab",
+			locked: LockedRef{
+				Type:    "gitlab",
+				Owner:   "a-h",
+				Repo:    "flakes",
+				Rev:     "64b80bfb",
+				NarHash: narHash,
+			},
+			expected: "gitlab:a-h/flakes/64b80bfb?narHash=" + encodedNarHash,
+		},
+		{
+			name: "sourcehut",
+			locked: LockedRef{
+				Type:    "sourcehut",
+				Owner:   "~a-h",
+				Repo:    "flakes",
+				Rev:     "64b80bfb",
+				NarHash: narHash,
+			},
+			expected: "sourcehut:~a-h/flakes/64b80bfb?narHash=" + encodedNarHash,
+		},
+		{
+			name: "git over ssh with submodules",
+			locked: LockedRef{
+				Type:         "git",
+				URL:          "ssh://git@git.example.com/mirrors/flakes",
+				Ref:          "main",
+				Rev:          "64b80bfb",
+				Submodules:   true,
+				NarHash:      narHash,
+				LastModified: 1730137625,
+				RevCount:     12,
+			},
+			expected: "git+ssh://git@git.example.com/mirrors/flakes?lastModified=1730137625&narHash=" + encodedNarHash + "&ref=main&rev=64b80bfb&revCount=12&submodules=1",
+		},
+		{
+			name: "mercurial",
+			locked: LockedRef{
+				Type:    "hg",
+				URL:     "https://hg.example.com/flakes",
+				Ref:     "default",
+				Rev:     "64b80bfb",
+				NarHash: narHash,
+			},
+			expected: "hg+https://hg.example.com/flakes?narHash=" + encodedNarHash + "&ref=default&rev=64b80bfb",
+		},
+		{
+			name: "tarball",
+			locked: LockedRef{
+				Type:         "tarball",
+				URL:          "https://example.com/flakes.tar.gz",
+				NarHash:      narHash,
+				LastModified: 1730137625,
+			},
+			expected: "tarball+https://example.com/flakes.tar.gz?lastModified=1730137625&narHash=" + encodedNarHash,
+		},
+		{
+			name: "flakehub tarball keeps the query of the url",
+			locked: LockedRef{
+				Type:    "tarball",
+				URL:     "https://api.flakehub.com/f/pinned/NixOS/nixpkgs/0.1/source.tar.gz?rev=64b80bfb",
+				NarHash: narHash,
+			},
+			expected: "tarball+https://api.flakehub.com/f/pinned/NixOS/nixpkgs/0.1/source.tar.gz?narHash=" + encodedNarHash + "&rev=64b80bfb",
+		},
+		{
+			name: "file",
+			locked: LockedRef{
+				Type:    "file",
+				URL:     "https://example.com/flake.nix",
+				NarHash: narHash,
+			},
+			expected: "file+https://example.com/flake.nix?narHash=" + encodedNarHash,
+		},
+		{
+			name: "path",
+			locked: LockedRef{
+				Type:         "path",
+				Path:         "/nix/store/aaaa-source",
+				NarHash:      narHash,
+				LastModified: 1730137625,
+			},
+			expected: "path:/nix/store/aaaa-source?lastModified=1730137625&narHash=" + encodedNarHash,
+		},
+		{
+			name: "relative path",
+			locked: LockedRef{
+				Type: "path",
+				Path: "./subflake",
+			},
+			expected: "path:./subflake",
+		},
+		{
+			name: "github without rev",
+			locked: LockedRef{
+				Type:  "github",
+				Owner: "NixOS",
+				Repo:  "nixpkgs",
+			},
+			expectErr: true,
+		},
+		{
+			name: "git without url",
+			locked: LockedRef{
+				Type: "git",
+				Rev:  "64b80bfb",
+			},
+			expectErr: true,
+		},
+		{
+			name: "unsupported type",
+			locked: LockedRef{
+				Type: "indirect",
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := test.locked.FlakeRef()
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got ref %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Errorf("unexpected ref (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFlakeLockPathInputs(t *testing.T) {
+	l, err := ReadFlakeLock(strings.NewReader(`{
+  "nodes": {
+    "absolute": {
+      "locked": { "path": "/home/a-h/absolute", "type": "path" }
+    },
+    "nixpkgs": {
+      "locked": { "owner": "NixOS", "repo": "nixpkgs", "rev": "080166c1", "type": "github" }
+    },
+    "remote": {
+      "inputs": {
+        "sub": "sub"
+      },
+      "locked": { "owner": "a-h", "repo": "remote", "rev": "6183dd54", "type": "github" }
+    },
+    "shared": {
+      "inputs": {
+        "nixpkgs": ["nixpkgs"],
+        "utils": "utils"
+      },
+      "locked": { "lastModified": 1, "narHash": "sha256-a", "path": "../shared", "type": "path" }
+    },
+    "sub": {
+      "locked": { "path": "./sub", "type": "path" }
+    },
+    "utils": {
+      "locked": { "path": "./utils", "type": "path" }
+    },
+    "root": {
+      "inputs": {
+        "absolute": "absolute",
+        "nixpkgs": "nixpkgs",
+        "remote": "remote",
+        "shared": "shared"
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`))
+	if err != nil {
+		t.Fatalf("failed to read flake.lock: %v", err)
+	}
+	actual, err := l.PathInputs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []PathInput{
+		{Name: "shared", Path: "../shared"},
+		{Name: "shared/utils", Path: "../shared/utils"},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected path inputs (-want +got):\n%s", diff)
+	}
+}
+
+// TestFlakeLockResolveRef tests getting the locked flake reference of the nixpkgs input of the root flake.
+func TestFlakeLockResolveRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		nixLockFile string
+		expected    string
+	}{
+		{
+			name: "github input with a renamed lock node",
+			nixLockFile: `{
+  "nodes": {
+    "flake-compat": {
+      "flake": false,
+      "locked": {
+        "lastModified": 1673956053,
+        "narHash": "sha256-4gtG9iQuiKITOjNQQeQIpoIB6b16fm+504Ch3sNKLd8=",
+        "owner": "edolstra",
+        "repo": "flake-compat",
+        "rev": "35bb57c0c8d8b62bbfd284272c928ceb64ddbde9",
+        "type": "github"
+      },
+      "original": {
+        "owner": "edolstra",
+        "repo": "flake-compat",
+        "type": "github"
+      }
+    },
+    "flake-parts": {
+      "inputs": {
+        "nixpkgs-lib": [
+          "nix",
+          "nixpkgs"
+        ]
+      },
+      "locked": {
+        "lastModified": 1712014858,
+        "narHash": "sha256-sB4SWl2lX95bExY2gMFG5HIzvva5AVMJd4Igm+GpZNw=",
+        "owner": "hercules-ci",
+        "repo": "flake-parts",
+        "rev": "9126214d0a59633752a136528f5f3b9aa8565b7d",
+        "type": "github"
+      },
+      "original": {
+        "owner": "hercules-ci",
+        "repo": "flake-parts",
+        "type": "github"
+      }
+    },
+    "flake-utils": {
+      "inputs": {
+        "systems": "systems"
+      },
+      "locked": {
+        "lastModified": 1694529238,
+        "narHash": "sha256-zsNZZGTGnMOf9YpHKJqMSsa0dXbfmxeoJ7xHlrt+xmY=",
+        "owner": "numtide",
+        "repo": "flake-utils",
+        "rev": "ff7b65b44d01cf9ba6a71320833626af21126384",
+        "type": "github"
+      },
+      "original": {
+        "owner": "numtide",
+        "repo": "flake-utils",
+        "type": "github"
+      }
+    },
+    "flake-utils_2": {
+      "locked": {
+        "lastModified": 1667395993,
+        "narHash": "sha256-nuEHfE/LcWyuSWnS8t12N1wc105Qtau+/OdUAjtQ0rA=",
+        "owner": "numtide",
+        "repo": "flake-utils",
+        "rev": "5aed5285a952e0b949eb3ba02c12fa4fcfef535f",
+        "type": "github"
+      },
+      "original": {
+        "owner": "numtide",
+        "repo": "flake-utils",
+        "type": "github"
+      }
+    },
+    "git-hooks-nix": {
+      "inputs": {
+        "flake-compat": [
+          "nix"
+        ],
+        "gitignore": [
+          "nix"
+        ],
+        "nixpkgs": [
+          "nix",
+          "nixpkgs"
+        ],
+        "nixpkgs-stable": [
+          "nix",
+          "nixpkgs"
+        ]
+      },
+      "locked": {
+        "lastModified": 1730302582,
+        "narHash": "sha256-W1MIJpADXQCgosJZT8qBYLRuZls2KSiKdpnTVdKBuvU=",
+        "owner": "cachix",
+        "repo": "git-hooks.nix",
+        "rev": "af8a16fe5c264f5e9e18bcee2859b40a656876cf",
+        "type": "github"
+      },
+      "original": {
+        "owner": "cachix",
+        "repo": "git-hooks.nix",
+        "type": "github"
+      }
+    },
+    "gitignore": {
+      "inputs": {
+        "nixpkgs": [
+          "nixpkgs"
+        ]
+      },
+      "locked": {
+        "lastModified": 1709087332,
+        "narHash": "sha256-HG2cCnktfHsKV0s4XW83gU3F57gaTljL9KNSuG6bnQs=",
+        "owner": "hercules-ci",
+        "repo": "gitignore.nix",
+        "rev": "637db329424fd7e46cf4185293b9cc8c88c95394",
+        "type": "github"
+      },
+      "original": {
+        "owner": "hercules-ci",
+        "repo": "gitignore.nix",
+        "type": "github"
+      }
+    },
+    "gomod2nix": {
+      "inputs": {
+        "flake-utils": "flake-utils",
+        "nixpkgs": [
+          "nixpkgs"
+        ]
+      },
+      "locked": {
+        "lastModified": 1729448365,
+        "narHash": "sha256-oquZeWTYWTr5IxfwEzgsxjtD8SSFZYLdO9DaQb70vNU=",
+        "owner": "nix-community",
+        "repo": "gomod2nix",
+        "rev": "5d387097aa716f35dd99d848dc26d8d5b62a104c",
+        "type": "github"
+      },
+      "original": {
+        "owner": "nix-community",
+        "repo": "gomod2nix",
+        "type": "github"
+      }
+    },
+    "libgit2": {
+      "flake": false,
+      "locked": {
+        "lastModified": 1715853528,
+        "narHash": "sha256-J2rCxTecyLbbDdsyBWn9w7r3pbKRMkI9E7RvRgAqBdY=",
+        "owner": "libgit2",
+        "repo": "libgit2",
+        "rev": "36f7e21ad757a3dacc58cf7944329da6bc1d6e96",
+        "type": "github"
+      },
+      "original": {
+        "owner": "libgit2",
+        "ref": "v1.8.1",
+        "repo": "libgit2",
+        "type": "github"
+      }
+    },
+    "nix": {
+      "inputs": {
+        "flake-compat": "flake-compat",
+        "flake-parts": "flake-parts",
+        "git-hooks-nix": "git-hooks-nix",
+        "libgit2": "libgit2",
+        "nixpkgs": "nixpkgs",
+        "nixpkgs-23-11": "nixpkgs-23-11",
+        "nixpkgs-regression": "nixpkgs-regression"
+      },
+      "locked": {
+        "lastModified": 1730321079,
+        "narHash": "sha256-XdeVy1/d6DEIYb3nOA6JIYF4fwMKNxtwJMgT3pHi+ko=",
+        "owner": "nixos",
+        "repo": "nix",
+        "rev": "597fcc98e18e3178734d06a9e7306250e8cb8d74",
+        "type": "github"
+      },
+      "original": {
+        "owner": "nixos",
+        "ref": "2.24.10",
+        "repo": "nix",
+        "type": "github"
+      }
+    },
+    "nixpkgs": {
+      "locked": {
+        "lastModified": 1730327045,
+        "narHash": "sha256-xKel5kd1AbExymxoIfQ7pgcX6hjw9jCgbiBjiUfSVJ8=",
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "080166c15633801df010977d9d7474b4a6c549d7",
+        "type": "github"
+      },
+      "original": {
+        "owner": "NixOS",
+        "ref": "nixos-24.05",
+        "repo": "nixpkgs",
+        "type": "github"
+      }
+    },
+    "nixpkgs-23-11": {
+      "locked": {
+        "lastModified": 1717159533,
+        "narHash": "sha256-oamiKNfr2MS6yH64rUn99mIZjc45nGJlj9eGth/3Xuw=",
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "a62e6edd6d5e1fa0329b8653c801147986f8d446",
+        "type": "github"
+      },
+      "original": {
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "a62e6edd6d5e1fa0329b8653c801147986f8d446",
+        "type": "github"
+      }
+    },
+    "nixpkgs-regression": {
+      "locked": {
+        "lastModified": 1643052045,
+        "narHash": "sha256-uGJ0VXIhWKGXxkeNnq4TvV3CIOkUJ3PAoLZ3HMzNVMw=",
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "215d4d0fd80ca5163643b03a33fde804a29cc1e2",
+        "type": "github"
+      },
+      "original": {
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "215d4d0fd80ca5163643b03a33fde804a29cc1e2",
+        "type": "github"
+      }
+    },
+    "nixpkgs_2": {
+      "locked": {
+        "lastModified": 1730137625,
+        "narHash": "sha256-9z8oOgFZiaguj+bbi3k4QhAD6JabWrnv7fscC/mt0KE=",
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "64b80bfb316b57cdb8919a9110ef63393d74382a",
+        "type": "github"
+      },
+      "original": {
+        "owner": "NixOS",
+        "ref": "nixos-24.05",
+        "repo": "nixpkgs",
+        "type": "github"
+      }
+    },
+    "root": {
+      "inputs": {
+        "gitignore": "gitignore",
+        "gomod2nix": "gomod2nix",
+        "nix": "nix",
+        "nixpkgs": "nixpkgs_2",
+        "xc": "xc"
+      }
+    },
+    "systems": {
+      "locked": {
+        "lastModified": 1681028828,
+        "narHash": "sha256-Vy1rq5AaRuLzOxct8nz4T6wlgyUR7zLU309k9mBC768=",
+        "owner": "nix-systems",
+        "repo": "default",
+        "rev": "da67096a3b9bf56a91d16901293e51ba5b49a27e",
+        "type": "github"
+      },
+      "original": {
+        "owner": "nix-systems",
+        "repo": "default",
+        "type": "github"
+      }
+    },
+    "xc": {
+      "inputs": {
+        "flake-utils": "flake-utils_2",
+        "nixpkgs": [
+          "nixpkgs"
+        ]
+      },
+      "locked": {
+        "lastModified": 1726502039,
+        "narHash": "sha256-Zbzr88XKEpLx2D6jaq6KT8S5Cxe76Q9BeYpOcy3fXQk=",
+        "owner": "joerdav",
+        "repo": "xc",
+        "rev": "6183dd54f074aa3a1b3efb716a04966e4b8bf6e5",
+        "type": "github"
+      },
+      "original": {
+        "owner": "joerdav",
+        "repo": "xc",
+        "type": "github"
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`,
+			expected: "github:NixOS/nixpkgs/64b80bfb316b57cdb8919a9110ef63393d74382a?narHash=sha256-9z8oOgFZiaguj%2Bbbi3k4QhAD6JabWrnv7fscC%2Fmt0KE%3D",
+		},
+		{
+			name: "tarball input",
+			nixLockFile: `{
+  "nodes": {
+    "nixpkgs": {
+      "locked": {
+        "lastModified": 1730137625,
+        "narHash": "sha256-9z8oOgFZiaguj+bbi3k4QhAD6JabWrnv7fscC/mt0KE=",
+        "rev": "64b80bfb316b57cdb8919a9110ef63393d74382a",
+        "revCount": 690827,
+        "type": "tarball",
+        "url": "https://api.flakehub.com/f/pinned/NixOS/nixpkgs/0.2405.690827%2Brev-64b80bfb316b57cdb8919a9110ef63393d74382a/0192d8f5-0c6f-7b2b-b2a7-3f2a8b0b8c6e/source.tar.gz"
+      },
+      "original": {
+        "type": "tarball",
+        "url": "https://flakehub.com/f/NixOS/nixpkgs/0.2405.%2A.tar.gz"
+      }
+    },
+    "root": {
+      "inputs": {
+        "nixpkgs": "nixpkgs"
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`,
+			expected: "tarball+https://api.flakehub.com/f/pinned/NixOS/nixpkgs/0.2405.690827%2Brev-64b80bfb316b57cdb8919a9110ef63393d74382a/0192d8f5-0c6f-7b2b-b2a7-3f2a8b0b8c6e/source.tar.gz?lastModified=1730137625&narHash=sha256-9z8oOgFZiaguj%2Bbbi3k4QhAD6JabWrnv7fscC%2Fmt0KE%3D&rev=64b80bfb316b57cdb8919a9110ef63393d74382a&revCount=690827",
+		},
+		{
+			name: "git input",
+			nixLockFile: `{
+  "nodes": {
+    "nixpkgs": {
+      "locked": {
+        "lastModified": 1730137625,
+        "narHash": "sha256-9z8oOgFZiaguj+bbi3k4QhAD6JabWrnv7fscC/mt0KE=",
+        "ref": "nixos-24.05",
+        "rev": "64b80bfb316b57cdb8919a9110ef63393d74382a",
+        "revCount": 690827,
+        "type": "git",
+        "url": "https://git.example.com/mirrors/nixpkgs"
+      },
+      "original": {
+        "ref": "nixos-24.05",
+        "type": "git",
+        "url": "https://git.example.com/mirrors/nixpkgs"
+      }
+    },
+    "root": {
+      "inputs": {
+        "nixpkgs": "nixpkgs"
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`,
+			expected: "git+https://git.example.com/mirrors/nixpkgs?lastModified=1730137625&narHash=sha256-9z8oOgFZiaguj%2Bbbi3k4QhAD6JabWrnv7fscC%2Fmt0KE%3D&ref=nixos-24.05&rev=64b80bfb316b57cdb8919a9110ef63393d74382a&revCount=690827",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := ReadFlakeLock(strings.NewReader(test.nixLockFile))
+			if err != nil {
+				t.Fatalf("failed to read flake.lock: %v", err)
+			}
+			node, err := l.Resolve("nixpkgs")
+			if err != nil {
+				t.Fatalf("failed to resolve nixpkgs: %v", err)
+			}
+			actual, err := l.Ref(node)
+			if err != nil {
+				t.Fatalf("failed to get nixpkgs reference: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Errorf("unexpected nixpkgs reference (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package nixcmd
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// FlakeMetadataOutput is the output of `nix flake metadata --json`.
+type FlakeMetadataOutput struct {
+	// URL is the locked URL of the flake. Older versions of Nix return it in LockedURL.
+	URL string `json:"url"`
+	// LockedURL is the locked URL of the flake, returned by older versions of Nix.
+	LockedURL string `json:"lockedUrl"`
+	// Path is the store path of the flake source.
+	Path string `json:"path"`
+	// Revision is the git commit of the flake, if the flake is a clean git repository.
+	Revision string `json:"revision"`
+	// DirtyRevision is set instead of Revision if the git repository has uncommitted changes.
+	DirtyRevision string `json:"dirtyRevision"`
+	// LastModified is the time of the commit, as a Unix timestamp.
+	LastModified int64 `json:"lastModified"`
+	// Locked is the locked reference of the flake.
+	Locked LockedRef `json:"locked"`
+	// Original is the flake reference as it was given.
+	Original LockedRef `json:"original"`
+}
+
+// Dir returns the slash separated subdirectory of the source tree at Path that contains the flake, e.g. sub for
+// github:owner/repo?dir=sub, or an empty string if the flake is at the root.
+func (m FlakeMetadataOutput) Dir() string {
+	return cmp.Or(m.Locked.Dir, m.Original.Dir)
+}
+
+// LockedFlakeURL returns the locked URL of the flake, for any version of Nix.
+func (m FlakeMetadataOutput) LockedFlakeURL() string {
+	if m.URL != "" {
+		return m.URL
+	}
+	return m.LockedURL
+}
+
+// FlakeMetadata returns the metadata of the flake ref, which is resolved relative to codeDir.
+//
+//	nix flake metadata --json <ref>
+func FlakeMetadata(stdout, stderr io.Writer, codeDir, ref string) (m FlakeMetadataOutput, err error) {
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		return m, fmt.Errorf("failed to find nix on path: %w", err)
+	}
+
+	stdoutBuffer := new(bytes.Buffer)
+	cmd := exec.Command(nixPath, "flake", "metadata", "--json", ref)
+	cmd.Env = getEnv()
+	cmd.Dir = codeDir
+
+	w, closer := ErrorBuffer(stdout, stderr)
+	cmd.Stdout = stdoutBuffer
+	cmd.Stderr = w
+	if err = closer(cmd.Run()); err != nil {
+		return m, fmt.Errorf("failed to run nix flake metadata: %w", err)
+	}
+	if err = json.Unmarshal(stdoutBuffer.Bytes(), &m); err != nil {
+		return m, fmt.Errorf("failed to parse nix flake metadata output: %w", err)
+	}
+	return m, nil
+}
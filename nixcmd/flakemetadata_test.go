@@ -0,0 +1,71 @@
+package nixcmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlakeMetadataDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "flake at the root of the source tree",
+			input:    `{"locked":{"type":"github","owner":"a-h","repo":"flakegap","rev":"abc"},"original":{"type":"github","owner":"a-h","repo":"flakegap"},"path":"/nix/store/abc-source"}`,
+			expected: "",
+		},
+		{
+			name:     "flake in a subdirectory",
+			input:    `{"locked":{"type":"github","owner":"a-h","repo":"flakegap","rev":"abc","dir":"sub"},"original":{"type":"github","owner":"a-h","repo":"flakegap","dir":"sub"},"path":"/nix/store/abc-source"}`,
+			expected: "sub",
+		},
+		{
+			name:     "subdirectory only in the original reference",
+			input:    `{"locked":{"type":"github","owner":"a-h","repo":"flakegap","rev":"abc"},"original":{"type":"github","owner":"a-h","repo":"flakegap","dir":"sub/flake"},"path":"/nix/store/abc-source"}`,
+			expected: "sub/flake",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m FlakeMetadataOutput
+			if err := json.Unmarshal([]byte(test.input), &m); err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if actual := m.Dir(); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFlakeMetadataLockedFlakeURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "url",
+			input:    `{"url":"github:a-h/flakegap/abc"}`,
+			expected: "github:a-h/flakegap/abc",
+		},
+		{
+			name:     "lockedUrl from older versions of Nix",
+			input:    `{"lockedUrl":"github:a-h/flakegap/abc"}`,
+			expected: "github:a-h/flakegap/abc",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m FlakeMetadataOutput
+			if err := json.Unmarshal([]byte(test.input), &m); err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if actual := m.LockedFlakeURL(); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
@@ -45,6 +45,21 @@ func (fso FlakeShowOutput) Derivations(architecture, platform string) (matches [
 	return matches
 }
 
+// Apps returns the names of the apps for the given system, e.g. "x86_64-linux".
+func (fso FlakeShowOutput) Apps(system string) (names []string) {
+	apps, ok := JSONMapValue[map[string]any](fso, "apps", system)
+	if !ok {
+		return nil
+	}
+	for name, v := range apps {
+		if app, ok := v.(map[string]any); ok && app["type"] == "app" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
 func findDerivation(architectureAndPlatform string, parents []string, m map[string]any) (matches []string) {
 	for k, v := range m {
 		if k == "type" && v == "derivation" && slices.Contains(parents, architectureAndPlatform) {
@@ -129,3 +129,40 @@ func TestFlakeShowDerivations(t *testing.T) {
 		}
 	}
 }
+
+func TestFlakeShowApps(t *testing.T) {
+	input := `{
+  "apps": {
+    "aarch64-linux": {
+      "default": {
+        "type": "app"
+      }
+    },
+    "x86_64-linux": {
+      "default": {
+        "type": "app"
+      },
+      "migrate": {
+        "description": "Run database migrations",
+        "type": "app"
+      }
+    }
+  },
+  "nixosConfigurations": {
+    "host": {
+      "type": "nixos-configuration"
+    }
+  }
+}`
+	var fso FlakeShowOutput
+	if err := json.Unmarshal([]byte(input), &fso); err != nil {
+		t.Fatalf("failed to unmarshal json: %v", err)
+	}
+	expected := []string{"default", "migrate"}
+	if diff := cmp.Diff(expected, fso.Apps("x86_64-linux")); diff != "" {
+		t.Error(diff)
+	}
+	if apps := fso.Apps("x86_64-darwin"); len(apps) != 0 {
+		t.Errorf("expected no apps, got %v", apps)
+	}
+}
@@ -0,0 +1,146 @@
+package nixcmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Installable is a flake output, and the installable used to build it.
+type Installable struct {
+	// Attribute is the attribute path of the flake output, e.g. packages.x86_64-linux.default or nixosConfigurations.host.
+	Attribute string
+	// Ref is the installable that builds the output, e.g. .#packages.x86_64-linux.default or
+	// .#nixosConfigurations.host.config.system.build.toplevel.
+	Ref string
+}
+
+// Nix expressions used with `nix eval --apply` to find the system of outputs that are not keyed by system.
+const (
+	configurationSystemsExpr = `builtins.mapAttrs (name: c: c.pkgs.stdenv.hostPlatform.system)`
+	appContextExpr           = `builtins.mapAttrs (name: app: builtins.attrNames (builtins.getContext app.program))`
+	hydraJobSystemsExpr      = `jobs:
+  let
+    find = path: v:
+      if builtins.isAttrs v && v ? type && v.type == "derivation" then [{ name = builtins.concatStringsSep "." path; value = v.system; }]
+      else if builtins.isAttrs v then builtins.concatLists (builtins.attrValues (builtins.mapAttrs (n: c: find (path ++ [ n ]) c) v))
+      else [ ];
+  in
+  builtins.listToAttrs (find [ ] jobs)`
+)
+
+// Installables returns the installables for all of the outputs of the flake in codeDir that can be built for the system, e.g. "x86_64-linux".
+//
+// In addition to the derivations returned by Derivations, it resolves:
+//
+//   - apps to the derivations of their programs.
+//   - nixosConfigurations to config.system.build.toplevel.
+//   - homeConfigurations to activationPackage.
+//   - hydraJobs that are not keyed by system to their derivations.
+//
+// Outputs are only included if their attribute path matches the filter.
+func Installables(stdout, stderr io.Writer, codeDir string, op FlakeShowOutput, filter OutputFilter, system string) (installables []Installable, err error) {
+	architecture, platform, err := SplitSystem(system)
+	if err != nil {
+		return nil, err
+	}
+	add := func(attr, ref string) {
+		if filter.Match(attr) {
+			installables = append(installables, Installable{Attribute: attr, Ref: ref})
+		}
+	}
+
+	for _, ref := range op.Derivations(architecture, platform) {
+		add(strings.TrimPrefix(ref, ".#"), ref)
+	}
+
+	if apps := op.Apps(system); len(apps) > 0 {
+		contexts, err := EvalJSON[map[string][]string](stdout, stderr, codeDir, ".#apps."+system, appContextExpr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get app programs: %w", err)
+		}
+		for _, name := range apps {
+			if filter.Match(fmt.Sprintf("apps.%s.%s", system, name)) {
+				installables = append(installables, appInstallables(system, name, contexts[name])...)
+			}
+		}
+	}
+
+	configurations := []struct {
+		output string
+		suffix string
+	}{
+		{output: "nixosConfigurations", suffix: "config.system.build.toplevel"},
+		{output: "homeConfigurations", suffix: "activationPackage"},
+	}
+	for _, c := range configurations {
+		if _, ok := op[c.output]; !ok {
+			continue
+		}
+		systems, err := EvalJSON[map[string]string](stdout, stderr, codeDir, ".#"+c.output, configurationSystemsExpr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s systems: %w", c.output, err)
+		}
+		for _, name := range configurationsForSystem(systems, system) {
+			attr := fmt.Sprintf("%s.%s", c.output, name)
+			add(attr, fmt.Sprintf(".#%s.%s", attr, c.suffix))
+		}
+	}
+
+	if _, ok := op["hydraJobs"]; ok {
+		jobs, err := EvalJSON[map[string]string](stdout, stderr, codeDir, ".#hydraJobs", hydraJobSystemsExpr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hydraJobs systems: %w", err)
+		}
+		for _, name := range hydraJobsForSystem(jobs, system) {
+			attr := "hydraJobs." + name
+			add(attr, ".#"+attr)
+		}
+	}
+
+	return installables, nil
+}
+
+// configurationsForSystem returns the sorted names of the configurations whose host system, from
+// configurationSystemsExpr, is the system.
+func configurationsForSystem(systems map[string]string, system string) (names []string) {
+	for _, name := range slices.Sorted(maps.Keys(systems)) {
+		if systems[name] == system {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// hydraJobsForSystem returns the sorted attribute paths of the hydraJobs, from hydraJobSystemsExpr, that build for the
+// system. Jobs keyed by system, e.g. hydraJobs.tests.x86_64-linux, are already included in the derivations, so they're
+// skipped.
+func hydraJobsForSystem(jobs map[string]string, system string) (names []string) {
+	for _, name := range slices.Sorted(maps.Keys(jobs)) {
+		if jobs[name] != system || slices.Contains(strings.Split(name, "."), system) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// appInstallables returns an installable for each store path in the string context of an app's program. If the
+// program refers to more than one store path, each installable's attribute is suffixed with its index, e.g.
+// apps.x86_64-linux.default-1, so that every output has a unique name.
+func appInstallables(system, name string, context []string) (installables []Installable) {
+	attr := fmt.Sprintf("apps.%s.%s", system, name)
+	for i, p := range context {
+		if strings.HasSuffix(p, ".drv") {
+			p += "^*"
+		}
+		installable := Installable{Attribute: attr, Ref: p}
+		if len(context) > 1 {
+			installable.Attribute = fmt.Sprintf("%s-%d", attr, i+1)
+		}
+		installables = append(installables, installable)
+	}
+	return installables
+}
@@ -0,0 +1,119 @@
+package nixcmd
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAppInstallables(t *testing.T) {
+	tests := []struct {
+		name     string
+		context  []string
+		expected []Installable
+	}{
+		{
+			name:    "a single derivation uses the app's attribute",
+			context: []string{"/nix/store/a-hello.drv"},
+			expected: []Installable{
+				{Attribute: "apps.x86_64-linux.default", Ref: "/nix/store/a-hello.drv^*"},
+			},
+		},
+		{
+			name:    "several store paths have unique attributes",
+			context: []string{"/nix/store/a-hello.drv", "/nix/store/b-script"},
+			expected: []Installable{
+				{Attribute: "apps.x86_64-linux.default-1", Ref: "/nix/store/a-hello.drv^*"},
+				{Attribute: "apps.x86_64-linux.default-2", Ref: "/nix/store/b-script"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := appInstallables("x86_64-linux", "default", test.context)
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestConfigurationsForSystem(t *testing.T) {
+	tests := []struct {
+		name     string
+		systems  map[string]string
+		expected []string
+	}{
+		{
+			name:     "no configurations",
+			systems:  nil,
+			expected: nil,
+		},
+		{
+			name: "configurations for other systems are skipped",
+			systems: map[string]string{
+				"server":  "x86_64-linux",
+				"pi":      "aarch64-linux",
+				"laptop":  "x86_64-linux",
+				"macbook": "aarch64-darwin",
+			},
+			expected: []string{"laptop", "server"},
+		},
+		{
+			name: "no configurations for the system",
+			systems: map[string]string{
+				"pi": "aarch64-linux",
+			},
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := configurationsForSystem(test.systems, "x86_64-linux")
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestHydraJobsForSystem(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobs     map[string]string
+		expected []string
+	}{
+		{
+			name:     "no jobs",
+			jobs:     nil,
+			expected: nil,
+		},
+		{
+			name: "jobs not keyed by system are included",
+			jobs: map[string]string{
+				"release":       "x86_64-linux",
+				"docs.manual":   "x86_64-linux",
+				"release-arm64": "aarch64-linux",
+			},
+			expected: []string{"docs.manual", "release"},
+		},
+		{
+			name: "jobs keyed by system are skipped",
+			jobs: map[string]string{
+				"tests.x86_64-linux":        "x86_64-linux",
+				"x86_64-linux.build":        "x86_64-linux",
+				"tests.aarch64-linux":       "aarch64-linux",
+				"installer.x86_64-linuxiso": "x86_64-linux",
+			},
+			expected: []string{"installer.x86_64-linuxiso"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := hydraJobsForSystem(test.jobs, "x86_64-linux")
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package nixcmd
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -73,7 +74,7 @@ func TestPathInfoOutputCanBeParsed(t *testing.T) {
 			t.Setenv("PATH", filepath.Dir(bin)+":"+os.Getenv("PATH"))
 
 			var stdout, stderr bytes.Buffer
-			paths, err := PathInfo(&stdout, &stderr, "..", false, false, storePath)
+			paths, err := PathInfo(context.Background(), &stdout, &stderr, "..", false, false, storePath)
 			if err != nil {
 				t.Fatalf("PathInfo failed: %v\nstderr: %s", err, stderr.String())
 			}
@@ -0,0 +1,15 @@
+package nixcmd
+
+func JSONMapValue[T any](m map[string]any, keys ...string) (v T, ok bool) {
+	if len(keys) == 0 {
+		return v, false
+	}
+	for _, k := range keys[:len(keys)-1] {
+		m, ok = m[k].(map[string]any)
+		if !ok {
+			return v, false
+		}
+	}
+	v, ok = m[keys[len(keys)-1]].(T)
+	return v, ok
+}
@@ -0,0 +1,99 @@
+package nixcmd
+
+import "testing"
+
+var m = map[string]any{
+	"a0": "a0_value",
+	"b0": "b0_value",
+	"c0": map[string]any{
+		"c1": "c1_value",
+		"c2": false, // Unsupported type.
+		"d2": 1,     // Unsupported type.
+		"e2": map[string]any{
+			"a3": "a3_value",
+			"b3": "b3_value",
+		},
+		"f2": []any{"f2_value"},       // Unsupported type.
+		"g2": map[string]int{"g2": 1}, // Unsupported type.
+	},
+}
+
+func TestJSONMapStringValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []string
+		expectedOK bool
+		expected   string
+	}{
+		{
+			name:       "nothing to find",
+			expectedOK: false,
+		},
+		{
+			name:       "key not found",
+			keys:       []string{"a-1"},
+			expectedOK: false,
+		},
+		{
+			name:       "key found",
+			keys:       []string{"a0"},
+			expectedOK: true,
+			expected:   "a0_value",
+		},
+		{
+			name:       "nested key found",
+			keys:       []string{"c0", "c1"},
+			expectedOK: true,
+			expected:   "c1_value",
+		},
+		{
+			name:       "nested key not found",
+			keys:       []string{"c0", "c-1"},
+			expectedOK: false,
+		},
+		{
+			name:       "nested key found, but unsupported type (bool)",
+			keys:       []string{"c0", "c2"},
+			expectedOK: false,
+		},
+		{
+			name:       "nested key found, but unsupported type (int)",
+			keys:       []string{"c0", "d2"},
+			expectedOK: false,
+		},
+		{
+			name:       "nested key found, but unsupported type (slice)",
+			keys:       []string{"c0", "f2"},
+			expectedOK: false,
+		},
+		{
+			name:       "nested key found, but unsupported type (map)",
+			keys:       []string{"c0", "g2"},
+			expectedOK: false,
+		},
+		{
+			name:       "nested key not found, missing intermediate key",
+			keys:       []string{"c0", "e-1", "a3"},
+			expectedOK: false,
+		},
+		{
+			name:       "nested nested key found",
+			keys:       []string{"c0", "e2", "a3"},
+			expectedOK: true,
+			expected:   "a3_value",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			actual, ok := JSONMapValue[string](m, test.keys...)
+			if ok != test.expectedOK {
+				t.Errorf("unexpected ok: want %v, got %v", test.expectedOK, ok)
+			}
+			if actual != test.expected {
+				t.Errorf("unexpected value: want %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
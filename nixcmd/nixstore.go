@@ -2,30 +2,64 @@ package nixcmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os/exec"
+	"slices"
 	"strings"
 )
 
 // nix copy --to file://$PWD/nix-export/nix-store `nix-store --realise $(nix path-info --recursive --derivation .#)`
-func NixStoreRealise(stdout, stderr io.Writer, targetStore string, pathsToRealise []string) (realisedPaths []string, err error) {
+func NixStoreRealise(ctx context.Context, stdout, stderr io.Writer, targetStore string, pathsToRealise []string) (realisedPaths []string, err error) {
 	nixPath, err := exec.LookPath("nix-store")
 	if err != nil {
 		return realisedPaths, fmt.Errorf("failed to find nix-store on path: %w", err)
 	}
 
-	stdoutBuffer := new(bytes.Buffer)
-	w, closer := ErrorBuffer(stdout, stderr)
+	for batch := range slices.Chunk(pathsToRealise, argBatchSize) {
+		stdoutBuffer := new(bytes.Buffer)
+		w, closer := ErrorBuffer(stdout, stderr)
 
-	args := append([]string{"--realise"}, pathsToRealise...)
-	cmd := exec.Command(nixPath, args...)
-	cmd.Env = getEnv()
-	cmd.Stdout = stdoutBuffer
-	cmd.Stderr = w
-	if err = closer(cmd.Run()); err != nil {
-		return realisedPaths, fmt.Errorf("failed to run nix-store --realise: %w", err)
+		args := append([]string{"--realise"}, batch...)
+		cmd := exec.CommandContext(ctx, nixPath, args...)
+		cmd.Env = getEnv()
+		cmd.Stdout = stdoutBuffer
+		cmd.Stderr = w
+		if err = closer(cmd.Run()); err != nil {
+			return realisedPaths, fmt.Errorf("failed to run nix-store --realise: %w", err)
+		}
+		realisedPaths = append(realisedPaths, strings.Split(strings.TrimSpace(stdoutBuffer.String()), "\n")...)
 	}
+	return realisedPaths, nil
+}
 
-	return strings.Split(strings.TrimSpace(stdoutBuffer.String()), "\n"), nil
+// NixStoreInvalidPaths returns the paths that are not valid in the local Nix store.
+//
+//	nix-store --check-validity --print-invalid <paths>
+func NixStoreInvalidPaths(stdout, stderr io.Writer, paths []string) (invalidPaths []string, err error) {
+	nixPath, err := exec.LookPath("nix-store")
+	if err != nil {
+		return invalidPaths, fmt.Errorf("failed to find nix-store on path: %w", err)
+	}
+
+	for batch := range slices.Chunk(paths, argBatchSize) {
+		stdoutBuffer := new(bytes.Buffer)
+		w, closer := ErrorBuffer(stdout, stderr)
+
+		args := append([]string{"--check-validity", "--print-invalid"}, batch...)
+		cmd := exec.Command(nixPath, args...)
+		cmd.Env = getEnv()
+		cmd.Stdout = stdoutBuffer
+		cmd.Stderr = w
+		if err = closer(cmd.Run()); err != nil {
+			return invalidPaths, fmt.Errorf("failed to run nix-store --check-validity: %w", err)
+		}
+		for _, p := range strings.Split(strings.TrimSpace(stdoutBuffer.String()), "\n") {
+			if p != "" {
+				invalidPaths = append(invalidPaths, p)
+			}
+		}
+	}
+	return invalidPaths, nil
 }
@@ -2,54 +2,105 @@ package nixcmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"os/exec"
+	"path"
 	"slices"
 	"strings"
 )
 
 // nix copy --to file://$PWD/nix-export/nix-store `nix-store --realise $(nix path-info --recursive --derivation .#)`
-func PathInfo(stdout, stderr io.Writer, codeDir string, recursive, derivation bool, ref string) (paths []string, err error) {
+func PathInfo(ctx context.Context, stdout, stderr io.Writer, codeDir string, recursive, derivation bool, ref string) (paths []string, err error) {
+	entries, err := PathInfoEntries(ctx, stdout, stderr, codeDir, PathInfoOptions{Recursive: recursive, Derivation: derivation}, ref)
+	if err != nil {
+		return paths, err
+	}
+	paths = make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.Path
+	}
+	return paths, nil
+}
+
+// PathInfoOptions are the flags passed to nix path-info.
+type PathInfoOptions struct {
+	// Recursive includes the closure of the refs.
+	Recursive bool
+	// Derivation queries the derivations of the refs, rather than their outputs.
+	Derivation bool
+	// ClosureSize includes the closure size of each path.
+	ClosureSize bool
+}
+
+// PathInfoEntry is the information about a store path returned by nix path-info.
+type PathInfoEntry struct {
+	Path        string   `json:"path"`
+	NarSize     uint64   `json:"narSize"`
+	ClosureSize uint64   `json:"closureSize"`
+	References  []string `json:"references"`
+	Deriver     string   `json:"deriver"`
+}
+
+// PathInfoEntries returns information about the refs, which may be installables or store paths.
+//
+//	nix path-info --json [--recursive] [--derivation] [--closure-size] <refs>
+func PathInfoEntries(ctx context.Context, stdout, stderr io.Writer, codeDir string, opts PathInfoOptions, refs ...string) (entries []PathInfoEntry, err error) {
 	nixPath, err := exec.LookPath("nix")
 	if err != nil {
-		return paths, fmt.Errorf("failed to find nix on path: %w", err)
+		return entries, fmt.Errorf("failed to find nix on path: %w", err)
 	}
 
 	base := []string{"path-info", "--json"}
-	if recursive {
+	if opts.Recursive {
 		base = append(base, "--recursive")
 	}
-	if derivation {
+	if opts.Derivation {
 		base = append(base, "--derivation")
 	}
+	if opts.ClosureSize {
+		base = append(base, "--closure-size")
+	}
 
-	args := append(slices.Clone(base), "--json-format", "1", ref)
-	outBytes, errBytes, runErr := runPathInfo(nixPath, codeDir, args)
-	if runErr != nil {
-		if strings.Contains(string(errBytes), "unrecognised flag") {
-			// --json-format is not supported by this Nix version; retry without it.
-			args = append(base, ref)
-			outBytes, errBytes, runErr = runPathInfo(nixPath, codeDir, args)
-		}
+	seen := make(map[string]struct{})
+	for batch := range slices.Chunk(refs, argBatchSize) {
+		args := append(slices.Clone(base), "--json-format", "1")
+		args = append(args, batch...)
+		outBytes, errBytes, runErr := runPathInfo(ctx, nixPath, codeDir, args)
 		if runErr != nil {
-			stderr.Write(errBytes) //nolint
-			return paths, fmt.Errorf("failed to run nix %s: %w", strings.Join(args, " "), runErr)
+			if strings.Contains(string(errBytes), "unrecognised flag") {
+				// --json-format is not supported by this Nix version; retry without it.
+				args = append(slices.Clone(base), batch...)
+				outBytes, errBytes, runErr = runPathInfo(ctx, nixPath, codeDir, args)
+			}
+			if runErr != nil {
+				stderr.Write(errBytes) //nolint
+				return entries, fmt.Errorf("failed to run nix %s: %w", strings.Join(args, " "), runErr)
+			}
 		}
-	}
-	stderr.Write(errBytes) //nolint
+		stderr.Write(errBytes) //nolint
 
-	paths, err = getPathInfo(outBytes)
-	if err != nil {
-		return paths, fmt.Errorf("failed to get path info from nix %s: %w", strings.Join(args, " "), err)
+		batchEntries, err := getPathInfoEntries(outBytes)
+		if err != nil {
+			return entries, fmt.Errorf("failed to get path info from nix %s: %w", strings.Join(args, " "), err)
+		}
+		for _, e := range batchEntries {
+			if _, ok := seen[e.Path]; ok {
+				continue
+			}
+			seen[e.Path] = struct{}{}
+			entries = append(entries, e)
+		}
 	}
-	return paths, nil
+	return entries, nil
 }
 
-func runPathInfo(nixPath, codeDir string, args []string) (out []byte, errOut []byte, err error) {
+func runPathInfo(ctx context.Context, nixPath, codeDir string, args []string) (out []byte, errOut []byte, err error) {
 	var outBuf, errBuf bytes.Buffer
-	cmd := exec.Command(nixPath, args...)
+	cmd := exec.CommandContext(ctx, nixPath, args...)
 	cmd.Env = getEnv()
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
@@ -58,43 +109,47 @@ func runPathInfo(nixPath, codeDir string, args []string) (out []byte, errOut []b
 	return outBuf.Bytes(), errBuf.Bytes(), err
 }
 
-func getPathInfo(stdout []byte) (paths []string, err error) {
+func getPathInfoEntries(stdout []byte) (entries []PathInfoEntry, err error) {
 	if len(stdout) == 0 {
-		return paths, fmt.Errorf("empty nix path-info output")
+		return entries, fmt.Errorf("empty nix path-info output")
 	}
 	switch string(stdout[:1]) {
 	case "[":
-		var op []pathInfoOutput
-		err = json.Unmarshal(stdout, &op)
+		err = json.Unmarshal(stdout, &entries)
 		if err != nil {
-			return paths, err
-		}
-
-		paths = make([]string, len(op))
-		for i, pio := range op {
-			paths[i] = pio.Path
+			return entries, err
 		}
-		return paths, nil
 	case "{":
-		var pio map[string]any
+		var pio map[string]*PathInfoEntry
 		err = json.Unmarshal(stdout, &pio)
 		if err != nil {
-			return paths, err
+			return entries, err
 		}
 
-		paths = make([]string, len(pio))
-		var i int
-		for k := range pio {
-			paths[i] = k
-			i++
+		entries = make([]PathInfoEntry, 0, len(pio))
+		for _, k := range slices.Sorted(maps.Keys(pio)) {
+			if pio[k] == nil {
+				// The path is not valid.
+				continue
+			}
+			e := *pio[k]
+			e.Path = k
+			entries = append(entries, e)
 		}
-		slices.Sort(paths)
-		return paths, nil
+	default:
+		return entries, fmt.Errorf("unexpected output: %s", string(stdout))
 	}
 
-	return paths, fmt.Errorf("unexpected output: %s", string(stdout))
-}
-
-type pathInfoOutput struct {
-	Path string `json:"path"`
+	for i, e := range entries {
+		// Some Nix versions output references as base names, rather than full store paths.
+		for j, ref := range e.References {
+			if !strings.HasPrefix(ref, "/") {
+				entries[i].References[j] = path.Join(path.Dir(e.Path), ref)
+			}
+		}
+		if e.Deriver != "" && !strings.HasPrefix(e.Deriver, "/") {
+			entries[i].Deriver = path.Join(path.Dir(e.Path), e.Deriver)
+		}
+	}
+	return entries, nil
 }
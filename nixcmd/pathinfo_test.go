@@ -63,7 +63,7 @@ func TestPathInfo(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			actual, err := getPathInfo([]byte(tt.stdout))
+			entries, err := getPathInfoEntries([]byte(tt.stdout))
 			if err != nil {
 				if tt.expectedErr == nil {
 					t.Fatalf("unexpected error: %v", err)
@@ -72,9 +72,55 @@ func TestPathInfo(t *testing.T) {
 					t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
 				}
 			}
+			var actual []string
+			for _, e := range entries {
+				actual = append(actual, e.Path)
+			}
 			if diff := cmp.Diff(tt.expected, actual); diff != "" {
 				t.Error(diff)
 			}
 		})
 	}
 }
+
+func TestPathInfoEntries(t *testing.T) {
+	stdout := `{
+  "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1": {
+    "closureSize": 1024,
+    "deriver": "8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv",
+    "narSize": 512,
+    "references": [
+      "fg5vmkpz7wzxaw3shq1a6l0n9ls0g8vj-openssl-3.0.14"
+    ]
+  },
+  "/nix/store/fg5vmkpz7wzxaw3shq1a6l0n9ls0g8vj-openssl-3.0.14": {
+    "closureSize": 512,
+    "deriver": null,
+    "narSize": 512,
+    "references": []
+  },
+  "/nix/store/zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz-invalid": null
+}`
+	expected := []PathInfoEntry{
+		{
+			Path:        "/nix/store/6cvh1xnv0vj0xhbl6jrg0a9pc97mzpbi-app-0.0.1",
+			NarSize:     512,
+			ClosureSize: 1024,
+			References:  []string{"/nix/store/fg5vmkpz7wzxaw3shq1a6l0n9ls0g8vj-openssl-3.0.14"},
+			Deriver:     "/nix/store/8b0b6v8jxg3i2rsf5p7kmw8jyvmbyfzm-app-0.0.1.drv",
+		},
+		{
+			Path:        "/nix/store/fg5vmkpz7wzxaw3shq1a6l0n9ls0g8vj-openssl-3.0.14",
+			NarSize:     512,
+			ClosureSize: 512,
+			References:  []string{},
+		},
+	}
+	actual, err := getPathInfoEntries([]byte(stdout))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
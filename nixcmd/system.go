@@ -0,0 +1,31 @@
+package nixcmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+var goArchToNixArchitecture = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+	"386":   "i686",
+}
+
+// HostSystem returns the Nix system of the machine flakegap is running on, e.g. "x86_64-linux".
+func HostSystem() string {
+	architecture, ok := goArchToNixArchitecture[runtime.GOARCH]
+	if !ok {
+		architecture = runtime.GOARCH
+	}
+	return fmt.Sprintf("%s-%s", architecture, runtime.GOOS)
+}
+
+// SplitSystem splits a Nix system, e.g. "x86_64-linux" into its architecture and platform.
+func SplitSystem(system string) (architecture, platform string, err error) {
+	architecture, platform, ok := strings.Cut(system, "-")
+	if !ok || architecture == "" || platform == "" {
+		return "", "", fmt.Errorf("invalid system %q, expected <architecture>-<platform>, e.g. x86_64-linux", system)
+	}
+	return architecture, platform, nil
+}
@@ -0,0 +1,29 @@
+package nixcmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Version returns the output of `nix --version`, e.g. "nix (Nix) 2.24.10".
+func Version(stdout, stderr io.Writer) (version string, err error) {
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		return version, fmt.Errorf("failed to find nix on path: %w", err)
+	}
+
+	stdoutBuffer := new(bytes.Buffer)
+	cmd := exec.Command(nixPath, "--version")
+	cmd.Env = getEnv()
+
+	w, closer := ErrorBuffer(stdout, stderr)
+	cmd.Stdout = stdoutBuffer
+	cmd.Stderr = w
+	if err = closer(cmd.Run()); err != nil {
+		return version, fmt.Errorf("failed to run nix --version: %w", err)
+	}
+	return strings.TrimSpace(stdoutBuffer.String()), nil
+}
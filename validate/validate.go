@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/a-h/flakegap/archive"
 	"github.com/a-h/flakegap/container"
+	"github.com/a-h/flakegap/manifest"
+	"github.com/a-h/flakegap/nixcmd"
 )
 
 type Args struct {
@@ -19,10 +24,15 @@ type Args struct {
 	Image string
 	// Help shows usage and quits.
 	Help bool
-	// Architecture is the architecture to build for, e.g. x86_64, aarch64.
-	Architecture string
-	// Platform is the platform to run the container on, e.g. linux, darwin.
+	// Platform is the Docker platform to run the container on, e.g. amd64, arm64.
+	// The exported Nix system that matches the platform is validated.
 	Platform string
+	// Include is a list of glob patterns over attribute paths of outputs to build, e.g. packages.*.default.
+	// Patterns that start with "!" exclude matching outputs. If Include and Exclude are empty, the patterns recorded
+	// in the export's manifest are used, so that the same outputs are built as were exported.
+	Include []string
+	// Exclude is a list of glob patterns over attribute paths of outputs to skip, e.g. packages.*.*-docker-image.
+	Exclude []string
 }
 
 func (a Args) Validate() error {
@@ -36,8 +46,8 @@ func (a Args) Validate() error {
 	if a.Platform == "" {
 		errs = append(errs, fmt.Errorf("platform is required"))
 	}
-	if a.Architecture == "" {
-		errs = append(errs, fmt.Errorf("architecture is required"))
+	if _, err := nixcmd.NewOutputFilter(a.Include, a.Exclude); err != nil {
+		errs = append(errs, err)
 	}
 	return errors.Join(errs...)
 }
@@ -61,13 +71,111 @@ func Run(ctx context.Context, log *slog.Logger, args Args) (err error) {
 	}
 	log.Info("Extracted archive", slog.Int("files", m.Files), slog.Int("dirs", m.Dirs))
 
-	log.Info("Running build in airgapped container without binary cache", slog.String("platform", containerPlatform.String()), slog.String("image", args.Image))
+	if _, err := os.Stat(filepath.Join(tgtPath, manifest.BaseFileName)); err == nil {
+		return fmt.Errorf("%q is a delta export, which can't be validated without its base export, validate a full export instead", args.ExportFileName)
+	}
+
+	system := containerPlatform.NixSystem()
+	systems, err := manifest.Systems(tgtPath)
+	if err != nil {
+		return err
+	}
+	if len(systems) == 0 {
+		// Exports created before per-system manifests only contain nix-export.txt, so assume they're for the system
+		// being validated.
+		if _, err := os.Stat(filepath.Join(tgtPath, manifest.FileName)); err != nil {
+			return fmt.Errorf("export does not contain %s: %w", manifest.FileName, err)
+		}
+		log.Warn("Export does not contain per-system manifests, assuming it was created for the platform", slog.String("system", system))
+		systems = []string{system}
+	}
+	if !slices.Contains(systems, system) {
+		return fmt.Errorf("export does not contain system %q required by platform %q, exported systems: %v", system, containerPlatform, systems)
+	}
+	architecture, platform, err := nixcmd.SplitSystem(system)
+	if err != nil {
+		return err
+	}
+	em, err := manifest.Read(filepath.Join(tgtPath, manifest.JSONFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	closure := em.ClosureMode()
+
+	// The source code is mounted at /code. Workspace exports mount sources/, and validate each flake within it.
+	sourcePath := filepath.Join(tgtPath, "source")
+	codeDirs := []string{path.Join("/code", em.Source.Dir)}
+	if len(em.Flakes) == 0 {
+		if err = checkPathInputs(sourcePath, em.Source.Dir); err != nil {
+			return err
+		}
+	} else {
+		sourcePath = filepath.Join(tgtPath, "sources")
+		codeDirs = nil
+		for _, f := range em.Flakes {
+			if err = checkPathInputs(filepath.Join(sourcePath, filepath.FromSlash(f.Name)), f.Source.Dir); err != nil {
+				return fmt.Errorf("flake %q: %w", f.Name, err)
+			}
+			codeDirs = append(codeDirs, path.Join("/code", f.Name, f.Source.Dir))
+		}
+	}
+
+	validateArgs := []string{"-architecture", architecture, "-platform", platform, "-closure", closure}
+	for _, dir := range codeDirs {
+		validateArgs = append(validateArgs, "-code-dir", dir)
+	}
+	include, exclude := args.Include, args.Exclude
+	if len(include) == 0 && len(exclude) == 0 {
+		include, exclude = em.Include, em.Exclude
+	}
+	for _, p := range include {
+		validateArgs = append(validateArgs, "-include", p)
+	}
+	for _, p := range exclude {
+		validateArgs = append(validateArgs, "-exclude", p)
+	}
+
+	log.Info("Running build in airgapped container without binary cache", slog.String("platform", containerPlatform.String()), slog.String("system", system), slog.String("closure", closure), slog.Int("flakes", len(codeDirs)), slog.String("image", args.Image))
 
-	codePath := filepath.Join(tgtPath, "source")
-	if err = container.Run(ctx, log, containerPlatform, args.Image, codePath, tgtPath, args.Architecture, args.Platform); err != nil {
+	if err = container.Run(ctx, log, containerPlatform, args.Image, sourcePath, tgtPath, validateArgs); err != nil {
 		return fmt.Errorf("failed to run container: %w", err)
 	}
 
 	log.Info("Complete")
 	return nil
 }
+
+// checkPathInputs checks that the relative path inputs in the flake.lock file of the flake in sourcePath/dir are
+// present within sourcePath, which is mounted into the container.
+func checkPathInputs(sourcePath, dir string) (err error) {
+	flakeDir := filepath.Join(sourcePath, filepath.FromSlash(dir))
+	f, err := os.Open(filepath.Join(flakeDir, "flake.lock"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open flake.lock: %w", err)
+	}
+	defer f.Close()
+	l, err := nixcmd.ReadFlakeLock(f)
+	if err != nil {
+		return err
+	}
+	inputs, err := l.PathInputs()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, input := range inputs {
+		inputDir := filepath.Join(flakeDir, filepath.FromSlash(input.Path))
+		rel, err := filepath.Rel(sourcePath, inputDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			errs = append(errs, fmt.Errorf("path input %q (%s) is outside of the exported source code", input.Name, input.Path))
+			continue
+		}
+		if _, err := os.Stat(inputDir); err != nil {
+			errs = append(errs, fmt.Errorf("path input %q (%s) is missing from the export, re-export with a version of flakegap that copies path inputs", input.Name, input.Path))
+		}
+	}
+	return errors.Join(errs...)
+}